@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Buffer is an open editor and where the display was scrolled to when it was
+// last shown, so switching back to it returns to the same view.
+type Buffer struct {
+	Editor  *Editor
+	ScrollX int
+	ScrollY int
+}
+
+// Name is the buffer's file path, or [No Name] when it has none.
+func (b *Buffer) Name() string {
+	if fm := b.Editor.GetFileManager(); fm.HasFile() {
+		return fm.GetFilePath()
+	}
+	return "[No Name]"
+}
+
+// BufferManager holds the open buffers and which of them is shown. Each
+// buffer has its own Editor, and so its own FileManager and undo history.
+type BufferManager struct {
+	buffers []*Buffer
+	current int
+}
+
+func NewBufferManager(editors []*Editor) *BufferManager {
+	m := &BufferManager{}
+	for _, editor := range editors {
+		m.buffers = append(m.buffers, &Buffer{Editor: editor})
+	}
+	return m
+}
+
+func (m *BufferManager) Current() *Buffer {
+	return m.buffers[m.current]
+}
+
+func (m *BufferManager) Index() int {
+	return m.current
+}
+
+func (m *BufferManager) Len() int {
+	return len(m.buffers)
+}
+
+// Buffers returns the open buffers in order. The slice must not be changed.
+func (m *BufferManager) Buffers() []*Buffer {
+	return m.buffers
+}
+
+// SwitchTo makes buffers[i] the current buffer.
+func (m *BufferManager) SwitchTo(i int) *Buffer {
+	m.current = max(0, min(i, len(m.buffers)-1))
+	return m.Current()
+}
+
+// Next switches to the buffer after the current one, wrapping to the first.
+func (m *BufferManager) Next() *Buffer {
+	return m.SwitchTo((m.current + 1) % len(m.buffers))
+}
+
+// Prev switches to the buffer before the current one, wrapping to the last.
+func (m *BufferManager) Prev() *Buffer {
+	return m.SwitchTo((m.current + len(m.buffers) - 1) % len(m.buffers))
+}
+
+// Open adds editor as a buffer after the current one and switches to it.
+func (m *BufferManager) Open(editor *Editor) *Buffer {
+	m.buffers = slices.Insert(m.buffers, m.current+1, &Buffer{Editor: editor})
+	return m.SwitchTo(m.current + 1)
+}
+
+// Replace puts editor in place of the buffer at i, scrolled to the top.
+func (m *BufferManager) Replace(i int, editor *Editor) {
+	m.buffers[i] = &Buffer{Editor: editor}
+}
+
+// IndexOf returns the index of the buffer holding editor, or -1.
+func (m *BufferManager) IndexOf(editor *Editor) int {
+	return slices.IndexFunc(m.buffers, func(b *Buffer) bool {
+		return b.Editor == editor
+	})
+}
+
+// FindFile returns the index of the buffer editing the file at path, or -1.
+func (m *BufferManager) FindFile(path string) int {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return -1
+	}
+	return slices.IndexFunc(m.buffers, func(b *Buffer) bool {
+		fm := b.Editor.GetFileManager()
+		if !fm.HasFile() {
+			return false
+		}
+		other, err := filepath.Abs(fm.GetFilePath())
+		return err == nil && other == path
+	})
+}
+
+// Remove drops the current buffer without closing its editor and switches
+// to the one after it, or the one before if it was last. It reports whether
+// any buffers are left.
+func (m *BufferManager) Remove() bool {
+	m.buffers = slices.Delete(m.buffers, m.current, m.current+1)
+	if len(m.buffers) == 0 {
+		m.current = 0
+		return false
+	}
+	m.SwitchTo(m.current)
+	return true
+}
+
+// List describes the buffers one per line, marking the current one with >
+// and modified ones with [+].
+func (m *BufferManager) List() string {
+	var lines []string
+	for i, buffer := range m.buffers {
+		marker := " "
+		if i == m.current {
+			marker = ">"
+		}
+		line := fmt.Sprintf("%s %d %s", marker, i+1, buffer.Name())
+		if buffer.Editor.GetFileManager().IsDirty() {
+			line += " [+]"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBufferManager_NextPrevWrap(t *testing.T) {
+	m := NewBufferManager([]*Editor{NewEditor("a"), NewEditor("b"), NewEditor("c")})
+
+	if m.Prev(); m.Index() != 2 {
+		t.Errorf("Expected Prev to wrap to 2, got %d", m.Index())
+	}
+	if m.Next(); m.Index() != 0 {
+		t.Errorf("Expected Next to wrap to 0, got %d", m.Index())
+	}
+	if m.Next(); m.Current().Editor.GetBuffer().String() != "b" {
+		t.Errorf("Expected buffer b, got %q", m.Current().Editor.GetBuffer().String())
+	}
+}
+
+func TestBufferManager_OpenAndRemove(t *testing.T) {
+	a, b, c := NewEditor("a"), NewEditor("b"), NewEditor("c")
+	m := NewBufferManager([]*Editor{a, b})
+
+	if m.Open(c); m.Index() != 1 || m.IndexOf(c) != 1 || m.IndexOf(b) != 2 {
+		t.Errorf("Expected c opened after the current buffer, got index %d", m.Index())
+	}
+
+	m.SwitchTo(2)
+	if !m.Remove() || m.Current().Editor != c {
+		t.Errorf("Expected removing the last buffer to move back to c")
+	}
+	if !m.Remove() || m.Current().Editor != a {
+		t.Errorf("Expected removing c to move to a")
+	}
+	if m.Remove() {
+		t.Errorf("Expected no buffers left")
+	}
+}
+
+func TestBufferManager_KeepsViewPerBuffer(t *testing.T) {
+	m := NewBufferManager([]*Editor{NewEditor("a"), NewEditor("b")})
+	m.Current().ScrollY = 40
+
+	m.Next().ScrollX = 5
+	if m.Prev(); m.Current().ScrollY != 40 || m.Current().ScrollX != 0 {
+		t.Errorf("Expected the first buffer's view kept, got %d,%d", m.Current().ScrollX, m.Current().ScrollY)
+	}
+}
+
+func TestBufferManager_FindFileAndList(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := writeTestFile(path, "text"); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+
+	m := NewBufferManager([]*Editor{NewEditor("scratch"), opened})
+	if i := m.FindFile(filepath.Join(dir, ".", "a.txt")); i != 1 {
+		t.Errorf("Expected the file's buffer at 1, got %d", i)
+	}
+	if i := m.FindFile(filepath.Join(dir, "b.txt")); i != -1 {
+		t.Errorf("Expected no buffer for another file, got %d", i)
+	}
+
+	opened.TypeAtCursor("x")
+	lines := strings.Split(m.List(), "\n")
+	if lines[0] != "> 1 [No Name]" || lines[1] != "  2 "+path+" [+]" {
+		t.Errorf("Expected the current and modified buffers marked, got %q", lines)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// version is set when building a release with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+const usageText = `Usage: texteditor [options] [+LINE[:COL]] [FILE[:LINE[:COL]]]...
+
+Opens each FILE in its own buffer, showing the first; quitting one moves on
+to the next. +LINE[:COL] puts the cursor on that line and column of the file
+after it, as does a FILE:LINE:COL suffix. COL counts characters, as compiler
+and grep messages do, not screen columns. A FILE of "-" reads standard
+input, and its edited text is written to standard output on exit when that
+is not a terminal.
+
+Options:
+`
+
+// fileArg is a file named on the command line and where to put the cursor in
+// it. Line and Col count from 1; zero means not given. Col counts runes.
+type fileArg struct {
+	Path string
+	Line int
+	Col  int
+}
+
+// cliOptions is the parsed command line.
+type cliOptions struct {
+	Files    []fileArg
+	ReadOnly bool
+	Encoding string
+	Config   string
+	Version  bool
+	Help     bool
+
+	explicit map[string]bool
+}
+
+// parseArgs parses the arguments after the program name. Flags may come
+// before, between or after files, and "--" ends them. Usage and flag errors
+// are written to output.
+func parseArgs(args []string, output io.Writer) (*cliOptions, error) {
+	opts := &cliOptions{explicit: make(map[string]bool)}
+
+	fs := flag.NewFlagSet("texteditor", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.BoolVar(&opts.ReadOnly, "readonly", false, "open files without allowing edits")
+	fs.StringVar(&opts.Encoding, "encoding", "", "read files as `ENCODING` instead of detecting it")
+	fs.StringVar(&opts.Config, "config", "", "read defaults from the JSON config `FILE`")
+	fs.BoolVar(&opts.Version, "version", false, "print the version and exit")
+	fs.BoolVar(&opts.Help, "help", false, "show this help and exit")
+	fs.Usage = func() {
+		fmt.Fprint(output, usageText)
+		fs.PrintDefaults()
+	}
+
+	// Flag errors are printed by fs; print ours the same way.
+	fail := func(err error) (*cliOptions, error) {
+		fmt.Fprintln(output, err)
+		return nil, err
+	}
+
+	var line, col int
+	onlyFiles := false
+	for len(args) > 0 {
+		rest := args
+		if !onlyFiles {
+			if err := fs.Parse(args); err != nil {
+				return nil, err
+			}
+			rest = fs.Args()
+			if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+				onlyFiles = true
+			}
+			if len(rest) == 0 {
+				break
+			}
+		}
+		arg := rest[0]
+		args = rest[1:]
+
+		if strings.HasPrefix(arg, "+") && !onlyFiles {
+			var ok bool
+			line, col, ok = parsePosition(arg[1:])
+			if !ok {
+				return fail(fmt.Errorf("invalid position %q, expected +LINE or +LINE:COL", arg))
+			}
+			continue
+		}
+
+		file := parseFileArg(arg)
+		if line > 0 {
+			file.Line, file.Col = line, col
+			line, col = 0, 0
+		}
+		opts.Files = append(opts.Files, file)
+	}
+	if line > 0 {
+		return fail(fmt.Errorf("+%d must come before the file it applies to", line))
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		opts.explicit[f.Name] = true
+	})
+	if opts.Encoding != "" {
+		if _, err := ParseEncoding(opts.Encoding); err != nil {
+			return fail(err)
+		}
+	}
+	if opts.Help {
+		fs.Usage()
+	}
+	return opts, nil
+}
+
+// loadConfig reads the file given with --config, or the default config file
+// if there is one, and applies it.
+func (o *cliOptions) loadConfig() error {
+	path, required := o.Config, true
+	if path == "" {
+		var err error
+		path, err = defaultConfigPath()
+		if err != nil {
+			// Without a config directory there is simply no config.
+			return nil
+		}
+		required = false
+	}
+
+	config, err := LoadConfig(path, required)
+	if err != nil {
+		return err
+	}
+	o.applyConfig(config)
+	return nil
+}
+
+// applyConfig fills in options that were not given on the command line from
+// the config file.
+func (o *cliOptions) applyConfig(config *Config) {
+	if !o.explicit["readonly"] {
+		o.ReadOnly = config.ReadOnly
+	}
+	if !o.explicit["encoding"] {
+		o.Encoding = config.Encoding
+	}
+}
+
+// parsePosition parses LINE or LINE:COL, both counting from 1.
+func parsePosition(s string) (line, col int, ok bool) {
+	lineText, colText, hasCol := strings.Cut(s, ":")
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return 0, 0, false
+	}
+	if !hasCol {
+		return line, 0, true
+	}
+	col, err = strconv.Atoi(colText)
+	if err != nil || col < 1 {
+		return 0, 0, false
+	}
+	return line, col, true
+}
+
+// parseFileArg splits a FILE:LINE or FILE:LINE:COL reference, as printed by
+// compilers and grep, with or without a trailing colon. A file that exists
+// under the whole name is taken as it is, so names with colons still open.
+func parseFileArg(arg string) fileArg {
+	if _, err := os.Stat(arg); err == nil {
+		return fileArg{Path: arg}
+	}
+
+	parts := strings.Split(strings.TrimSuffix(arg, ":"), ":")
+	// The first part is always kept for the path itself.
+	numbers := 0
+	for i := len(parts) - 1; i > 0 && numbers < 2; i-- {
+		if n, err := strconv.Atoi(parts[i]); err != nil || n < 1 {
+			break
+		}
+		numbers++
+	}
+	if numbers == 0 {
+		return fileArg{Path: arg}
+	}
+
+	file := fileArg{Path: strings.Join(parts[:len(parts)-numbers], ":")}
+	file.Line, _ = strconv.Atoi(parts[len(parts)-numbers])
+	if numbers == 2 {
+		file.Col, _ = strconv.Atoi(parts[len(parts)-1])
+	}
+	return file
+}
+
+// openEditors opens an editor for each file on the command line, or one on
+// the welcome text when none were given. The editor reading standard input,
+// if any, is also returned on its own.
+func (o *cliOptions) openEditors() (editors []*Editor, stdin *Editor, err error) {
+	var enc Encoding
+	if o.Encoding != "" {
+		enc, _ = ParseEncoding(o.Encoding)
+	}
+
+	for _, file := range o.Files {
+		var editor *Editor
+		switch {
+		case file.Path == "-" && stdin != nil:
+			return nil, nil, errors.New("standard input can only be opened once")
+		case file.Path == "-" && o.Encoding != "":
+			editor, err = NewEditorFromReaderWithEncoding(os.Stdin, enc)
+			stdin = editor
+		case file.Path == "-":
+			editor, err = NewEditorFromReader(os.Stdin)
+			stdin = editor
+		default:
+			editor, err = o.openFile(file.Path)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %w", file.Path, err)
+		}
+
+		if file.Line > 0 {
+			editor.GoToLineRune(file.Line-1, max(file.Col-1, 0))
+		}
+		editors = append(editors, editor)
+	}
+
+	if len(editors) == 0 {
+		editors = append(editors, NewEditor("Hello World!\nThis is a simple text editor.\nTry editing this text!"))
+	}
+	for _, editor := range editors {
+		editor.SetReadOnly(o.ReadOnly)
+	}
+	return editors, stdin, nil
+}
+
+// openFile opens path with the --encoding and --readonly options applied.
+// Files opened while editing go through it too.
+func (o *cliOptions) openFile(path string) (*Editor, error) {
+	var editor *Editor
+	var err error
+	if o.Encoding != "" {
+		enc, _ := ParseEncoding(o.Encoding)
+		editor, err = NewEditorFromFileWithEncoding(path, enc)
+	} else {
+		editor, err = NewEditorFromFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	editor.SetReadOnly(o.ReadOnly)
+	return editor, nil
+}
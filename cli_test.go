@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs_FilesPositionsAndFlags(t *testing.T) {
+	opts, err := parseArgs([]string{"--readonly", "+12", "a.go", "b.go:3:7", "--encoding", "latin1", "+4:2", "c.go"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+
+	expected := []fileArg{
+		{Path: "a.go", Line: 12},
+		{Path: "b.go", Line: 3, Col: 7},
+		{Path: "c.go", Line: 4, Col: 2},
+	}
+	if !reflect.DeepEqual(opts.Files, expected) {
+		t.Errorf("Expected files %+v, got %+v", expected, opts.Files)
+	}
+	if !opts.ReadOnly || opts.Encoding != "latin1" {
+		t.Errorf("Expected readonly latin1, got %v %q", opts.ReadOnly, opts.Encoding)
+	}
+}
+
+func TestParseArgs_DoubleDashEndsFlags(t *testing.T) {
+	opts, err := parseArgs([]string{"--", "--readonly", "+3"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	expected := []fileArg{{Path: "--readonly"}, {Path: "+3"}}
+	if !reflect.DeepEqual(opts.Files, expected) || opts.ReadOnly {
+		t.Errorf("Expected only files %+v, got %+v", expected, opts)
+	}
+}
+
+func TestParseArgs_Errors(t *testing.T) {
+	tests := [][]string{
+		{"+x", "a.go"},
+		{"+0", "a.go"},
+		{"a.go", "+3"},
+		{"--encoding", "ebcdic"},
+		{"--nope"},
+	}
+	for _, args := range tests {
+		if _, err := parseArgs(args, io.Discard); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestParseFileArg(t *testing.T) {
+	tests := map[string]fileArg{
+		"main.go":        {Path: "main.go"},
+		"main.go:10":     {Path: "main.go", Line: 10},
+		"main.go:10:4:":  {Path: "main.go", Line: 10, Col: 4},
+		"dir/a:b.txt:2":  {Path: "dir/a:b.txt", Line: 2},
+		"2024:12":        {Path: "2024", Line: 12},
+		"notes.txt:x":    {Path: "notes.txt:x"},
+		"notes.txt:0":    {Path: "notes.txt:0"},
+		"1:2:3":          {Path: "1", Line: 2, Col: 3},
+		"-":              {Path: "-"},
+		"main.go:10:4:5": {Path: "main.go:10", Line: 4, Col: 5},
+	}
+	for arg, expected := range tests {
+		if got := parseFileArg(arg); got != expected {
+			t.Errorf("parseFileArg(%q) = %+v, want %+v", arg, got, expected)
+		}
+	}
+}
+
+func TestParseFileArg_ExistingNameWithColon(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log:12")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if got := parseFileArg(path); got != (fileArg{Path: path}) {
+		t.Errorf("Expected the existing file to open as named, got %+v", got)
+	}
+}
+
+func TestCLIOptions_ApplyConfig_FlagsWin(t *testing.T) {
+	opts, err := parseArgs([]string{"--encoding", "utf-16le"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	opts.applyConfig(&Config{Encoding: "latin1", ReadOnly: true})
+
+	if opts.Encoding != "utf-16le" {
+		t.Errorf("Expected the flag's encoding to win, got %q", opts.Encoding)
+	}
+	if !opts.ReadOnly {
+		t.Error("Expected readonly from the config")
+	}
+}
+
+func TestCLIOptions_OpenEditors_AtPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	opts, err := parseArgs([]string{"--readonly", path + ":2:3"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	editors, stdin, err := opts.openEditors()
+	if err != nil {
+		t.Fatalf("openEditors failed: %v", err)
+	}
+	if len(editors) != 1 || stdin != nil {
+		t.Fatalf("Expected one file editor, got %d (stdin %v)", len(editors), stdin)
+	}
+	if editors[0].GetCursorPosition() != 6 {
+		t.Errorf("Expected cursor at line 2, col 3, got offset %d", editors[0].GetCursorPosition())
+	}
+	if !editors[0].IsReadOnly() {
+		t.Error("Expected the editor to be read-only")
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "unicode/utf8"
+
 type Command interface {
 	Execute()
 	Undo()
@@ -26,12 +28,12 @@ func NewInsertCommand(buffer *PieceTable, cursor *Cursor, text string, position
 
 func (c *InsertCommand) Execute() {
 	c.buffer.Insert(c.position, c.text)
-	c.cursor.SetPosition(c.position + len(c.text))
+	c.cursor.SetPosition(c.position + utf8.RuneCountInString(c.text))
 	c.cursorAfter = c.cursor.GetPosition()
 }
 
 func (c *InsertCommand) Undo() {
-	c.buffer.Delete(c.position, len(c.text))
+	c.buffer.Delete(c.position, utf8.RuneCountInString(c.text))
 	c.cursor.SetPosition(c.cursorBefore)
 }
 
@@ -66,3 +68,60 @@ func (c *DeleteCommand) Undo() {
 	c.buffer.Insert(c.position, c.deletedText)
 	c.cursor.SetPosition(c.cursorBefore)
 }
+
+// Append inserts text directly after the text this command inserted and folds
+// it into the command, so both are undone together.
+func (c *InsertCommand) Append(text string) {
+	end := c.end()
+	c.buffer.Insert(end, text)
+	c.text += text
+	c.cursor.SetPosition(end + utf8.RuneCountInString(text))
+	c.cursorAfter = c.cursor.GetPosition()
+}
+
+// end returns the offset just past the inserted text.
+func (c *InsertCommand) end() int {
+	return c.position + utf8.RuneCountInString(c.text)
+}
+
+// CompositeCommand runs several commands as a single undo step. Undo reverts
+// them in reverse order.
+type CompositeCommand struct {
+	commands []Command
+}
+
+func NewCompositeCommand(commands ...Command) *CompositeCommand {
+	return &CompositeCommand{
+		commands: commands,
+	}
+}
+
+func (c *CompositeCommand) Add(cmd Command) {
+	c.commands = append(c.commands, cmd)
+}
+
+func (c *CompositeCommand) Len() int {
+	return len(c.commands)
+}
+
+func (c *CompositeCommand) Execute() {
+	for _, cmd := range c.commands {
+		cmd.Execute()
+	}
+}
+
+func (c *CompositeCommand) Undo() {
+	for i := len(c.commands) - 1; i >= 0; i-- {
+		c.commands[i].Undo()
+	}
+}
+
+// NewReplaceCommand replaces length runes at position with text as one
+// command: a delete followed by an insert.
+func NewReplaceCommand(buffer *PieceTable, cursor *Cursor, position, length int, text string) *CompositeCommand {
+	replace := NewCompositeCommand(NewDeleteCommand(buffer, cursor, position, length))
+	if text != "" {
+		replace.Add(NewInsertCommand(buffer, cursor, text, position))
+	}
+	return replace
+}
@@ -157,3 +157,86 @@ func TestCommand_MultipleDeleteCommands(t *testing.T) {
 		t.Errorf("After undo 1, expected 'Hello World', got '%s'", buffer.String())
 	}
 }
+
+func TestCommand_InsertCommand_MultiByteText(t *testing.T) {
+	buffer := NewPieceTable("ab")
+	cursor := NewCursor()
+	cursor.SetPosition(1)
+
+	cmd := NewInsertCommand(buffer, cursor, "日本é", 1)
+	cmd.Execute()
+
+	if buffer.String() != "a日本éb" {
+		t.Errorf("Expected 'a日本éb', got '%s'", buffer.String())
+	}
+
+	if cursor.GetPosition() != 4 {
+		t.Errorf("Expected cursor at 4, got %d", cursor.GetPosition())
+	}
+
+	cmd.Undo()
+
+	if buffer.String() != "ab" {
+		t.Errorf("After undo, expected 'ab', got '%s'", buffer.String())
+	}
+
+	if cursor.GetPosition() != 1 {
+		t.Errorf("After undo, expected cursor at 1, got %d", cursor.GetPosition())
+	}
+}
+
+func TestCommand_InsertCommand_Append(t *testing.T) {
+	buffer := NewPieceTable("ad")
+	cursor := NewCursor()
+	cursor.SetPosition(1)
+
+	cmd := NewInsertCommand(buffer, cursor, "b", 1)
+	cmd.Execute()
+	cmd.Append("c")
+
+	if buffer.String() != "abcd" {
+		t.Errorf("Expected 'abcd', got '%s'", buffer.String())
+	}
+
+	if cursor.GetPosition() != 3 {
+		t.Errorf("Expected cursor at 3, got %d", cursor.GetPosition())
+	}
+
+	cmd.Undo()
+
+	if buffer.String() != "ad" {
+		t.Errorf("After undo, expected 'ad', got '%s'", buffer.String())
+	}
+}
+
+func TestCommand_CompositeCommand_UndoesInReverseOrder(t *testing.T) {
+	buffer := NewPieceTable("Hello World")
+	cursor := NewCursor()
+	cursor.SetPosition(6)
+
+	cmd := NewCompositeCommand(
+		NewDeleteCommand(buffer, cursor, 6, 5),
+		NewInsertCommand(buffer, cursor, "Go", 6),
+	)
+	cmd.Execute()
+
+	if buffer.String() != "Hello Go" {
+		t.Errorf("Expected 'Hello Go', got '%s'", buffer.String())
+	}
+
+	cmd.Undo()
+
+	if buffer.String() != "Hello World" {
+		t.Errorf("After undo, expected 'Hello World', got '%s'", buffer.String())
+	}
+
+	if cursor.GetPosition() != 6 {
+		t.Errorf("After undo, expected cursor at 6, got %d", cursor.GetPosition())
+	}
+
+	cmd.Execute()
+
+	if buffer.String() != "Hello Go" {
+		t.Errorf("After redo, expected 'Hello Go', got '%s'", buffer.String())
+	}
+}
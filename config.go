@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds defaults read from the config file. Command-line flags
+// override them.
+type Config struct {
+	// Encoding, when set, is used to read files instead of detecting theirs.
+	Encoding string `json:"encoding,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// defaultConfigPath returns where the config file is looked for when
+// --config is not given.
+func defaultConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "texteditor", "config.json"), nil
+}
+
+// LoadConfig reads the JSON config file at path. A missing file is only an
+// error when required is set, as when the path was given explicitly.
+func LoadConfig(path string, required bool) (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.Encoding != "" {
+		if _, err := ParseEncoding(config.Encoding); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return config, nil
+}
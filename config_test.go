@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig_ReadsSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"encoding": "cp1252", "readOnly": true}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(path, true)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.Encoding != "cp1252" || !config.ReadOnly {
+		t.Errorf("Expected config settings, got %+v", config)
+	}
+}
+
+func TestLoadConfig_Missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	config, err := LoadConfig(path, false)
+	if err != nil || *config != (Config{}) {
+		t.Errorf("Expected an empty config for a missing default file, got %+v, %v", config, err)
+	}
+	if _, err := LoadConfig(path, true); err == nil {
+		t.Error("Expected an error for a missing --config file")
+	}
+}
+
+func TestLoadConfig_RejectsUnknownEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"encoding": "ebcdic"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadConfig(path, true); err == nil {
+		t.Error("Expected an error for an unknown encoding")
+	}
+}
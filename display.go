@@ -3,24 +3,103 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
 
+// Display draws the windows of a layout, each with its own gutter and status
+// line. Keys go to the editor of the focused window.
 type Display struct {
-	editor  *Editor
-	scrollX int
-	scrollY int
+	layout    *Layout
+	focus     *Window
+	focusPane Pane
+	message   string
 }
 
 func NewDisplay(editor *Editor) *Display {
+	window := NewWindow(editor)
 	return &Display{
-		editor:  editor,
-		scrollX: 0,
-		scrollY: 0,
+		layout: NewLayout(window),
+		focus:  window,
 	}
 }
 
+// Editor returns the editor of the focused window.
+func (d *Display) Editor() *Editor {
+	return d.focus.editor
+}
+
+// SetEditor shows another editor in the focused window, starting from the
+// top of its buffer.
+func (d *Display) SetEditor(editor *Editor) {
+	d.focus.SetEditor(editor)
+}
+
+// ReplaceEditor shows editor in every window showing old, as when old is
+// closed.
+func (d *Display) ReplaceEditor(old, editor *Editor) {
+	for _, window := range d.layout.Windows() {
+		if window.editor == old {
+			window.SetEditor(editor)
+		}
+	}
+}
+
+// Scroll returns the line and column the focused window starts at.
+func (d *Display) Scroll() (x, y int) {
+	return d.focus.scrollX, d.focus.scrollY
+}
+
+// SetScroll moves the focused window's view, as when returning to a buffer
+// shown before. It is still adjusted to keep the cursor in view.
+func (d *Display) SetScroll(x, y int) {
+	d.focus.scrollX = x
+	d.focus.scrollY = y
+}
+
+// Split divides the focused window in two, both showing its editor at the
+// same place. The focus stays in the first half.
+func (d *Display) Split(direction SplitDirection) {
+	d.layout.Split(d.focus, direction)
+}
+
+// FocusNext moves the focus to the next window, wrapping to the first, and
+// returns its editor.
+func (d *Display) FocusNext() *Editor {
+	windows := d.layout.Windows()
+	i := slices.Index(windows, d.focus)
+	d.focusWindow(windows[(i+1)%len(windows)])
+	return d.focus.editor
+}
+
+// CloseWindow closes the focused window and focuses the next one. The last
+// window is not closed.
+func (d *Display) CloseWindow() bool {
+	windows := d.layout.Windows()
+	if len(windows) == 1 {
+		return false
+	}
+	closing := d.focus
+	d.focusWindow(windows[(slices.Index(windows, closing)+1)%len(windows)])
+	return d.layout.Close(closing)
+}
+
+// OnlyWindow closes every window but the focused one.
+func (d *Display) OnlyWindow() {
+	d.layout.Only(d.focus)
+}
+
+// focusWindow hands the editor's cursor over to window. The window losing
+// the focus keeps its cursor where it was.
+func (d *Display) focusWindow(window *Window) {
+	d.focus.cursor = d.focus.editor.GetCursorPosition()
+	d.focus = window
+	line, col := window.editor.GetBuffer().GetLineColumn(window.cursor)
+	window.editor.GoToLineColumn(line, col)
+}
+
 func (d *Display) Init() error {
 	return termbox.Init()
 }
@@ -29,20 +108,26 @@ func (d *Display) Close() {
 	termbox.Close()
 }
 
+// SetMessage shows text in place of the key help on the status bar until it
+// is replaced or cleared with an empty message.
+func (d *Display) SetMessage(message string) {
+	d.message = message
+}
+
 func (d *Display) Render() {
-	d.renderEditor()
-	d.renderStatusBar()
+	d.renderWindows()
 	termbox.Flush()
 }
 
+// RenderWithPrompt shows the prompt over the focused window's status line.
 func (d *Display) RenderWithPrompt(prompt, input string) {
-	d.renderEditor()
+	d.renderWindows()
 	d.renderPrompt(prompt, input)
 	termbox.Flush()
 }
 
-func (d *Display) getLineNumberWidth() int {
-	lineCount := d.editor.GetBuffer().GetLineCount()
+func getLineNumberWidth(editor *Editor) int {
+	lineCount := editor.GetBuffer().GetLineCount()
 	width := 1
 	for n := lineCount; n >= 10; n /= 10 {
 		width++
@@ -50,104 +135,154 @@ func (d *Display) getLineNumberWidth() int {
 	return width + 1
 }
 
-func (d *Display) renderEditor() {
-	d.adjustScrollForCursor()
+func (d *Display) renderWindows() {
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 
 	width, height := termbox.Size()
-	visibleLines := height - 1 // Hard code 1 line for status bar. Yes its a magic number.
-	lineNumWidth := d.getLineNumberWidth()
-	visibleCols := width - lineNumWidth
-
-	for i := range visibleLines {
-		lineNum := d.scrollY + i + 1
-		lineText := fmt.Sprintf("%*d ", lineNumWidth-1, lineNum)
-		for j, r := range lineText {
-			termbox.SetCell(j, i, r, termbox.ColorYellow, termbox.ColorDefault)
+	for _, pane := range d.layout.Arrange(0, 0, width, height) {
+		if pane.Window == d.focus {
+			d.focusPane = pane
 		}
-	}
-
-	text := d.editor.GetText()
-	cursorPos := d.editor.GetCursorPosition()
-	hasSelection := d.editor.HasSelection()
-	selStart, selEnd := d.editor.GetSelection()
-
-	x, y := lineNumWidth, 0
-	lineNum := 0
-	colNum := 0
-
-	for i, r := range []rune(text) {
-		if lineNum < d.scrollY {
-			if r == '\n' {
-				lineNum++
-				colNum = 0
-			} else {
-				colNum++
+		if pane.X > 0 {
+			for y := pane.Y; y < pane.Y+pane.Height; y++ {
+				termbox.SetCell(pane.X-1, y, '│', termbox.ColorDefault, termbox.ColorDefault)
 			}
-			continue
 		}
-
-		if y >= visibleLines {
-			break
-		}
-
-		fg := termbox.ColorDefault
-		bg := termbox.ColorDefault
-
-		if hasSelection && i >= selStart && i < selEnd {
-			fg = termbox.ColorBlack
-			bg = termbox.ColorCyan
+		if pane.Height < 1 {
+			continue
 		}
+		d.renderWindow(pane)
+		d.renderStatusBar(pane)
+	}
+}
 
-		if i == cursorPos {
-			bg = termbox.ColorWhite
-			fg = termbox.ColorBlack
-		}
+// renderWindow draws the text of a window. Only the focused window shows the
+// cursor and selection; the others keep the view they had, following edits.
+func (d *Display) renderWindow(pane Pane) {
+	w := pane.Window
+	focused := w == d.focus
+	visibleLines := pane.Height - 1 // The last line of the pane is its status line.
+	lineNumWidth := getLineNumberWidth(w.editor)
+	visibleCols := pane.Width - lineNumWidth
+
+	buffer := w.editor.GetBuffer()
+	cursorPos := -1
+	hasSelection := false
+	var selStart, selEnd int
+	if focused {
+		cursorPos = w.editor.GetCursorPosition()
+		hasSelection = w.editor.HasSelection()
+		selStart, selEnd = w.editor.GetSelection()
+		d.adjustScrollForCursor(w, visibleLines, visibleCols, cursorPos)
+		w.top = buffer.lineStart(w.scrollY)
+	} else {
+		w.scrollY = buffer.lineBreaksBefore(min(w.top, buffer.Length()))
+	}
 
-		if r == '\n' {
-			if i == cursorPos && colNum >= d.scrollX && colNum < d.scrollX+visibleCols {
-				termbox.SetCell(lineNumWidth+colNum-d.scrollX, y, ' ', fg, bg)
+	for i := range visibleLines {
+		lineNum := w.scrollY + i + 1
+		lineText := fmt.Sprintf("%*d ", lineNumWidth-1, lineNum)
+		for j, r := range lineText {
+			if j < pane.Width {
+				termbox.SetCell(pane.X+j, pane.Y+i, r, termbox.ColorYellow, termbox.ColorDefault)
 			}
-			y++
-			lineNum++
-			colNum = 0
-			x = lineNumWidth
-			continue
 		}
+	}
 
-		if colNum >= d.scrollX && colNum < d.scrollX+visibleCols {
-			termbox.SetCell(x, y, r, fg, bg)
-			x++
-		}
+	lineStart := buffer.GetOffsetFromLineColumn(w.scrollY, 0)
 
-		colNum++
+	var matches [][2]int
+	if search := w.editor.GetSearch(); search != nil {
+		matches = search.Matches(buffer, lineStart, buffer.lineStart(w.scrollY+visibleLines))
 	}
+	match := 0
+
+	for y, line := range buffer.Lines(w.scrollY, w.scrollY+visibleLines) {
+		i := lineStart
+		colNum := 0
+		for _, cluster := range graphemeClusters([]rune(line)) {
+			clusterWidth := graphemeWidth(cluster)
+			for match < len(matches) && matches[match][1] <= i {
+				match++
+			}
+			if colNum >= w.scrollX && colNum+clusterWidth <= w.scrollX+visibleCols {
+				fg := termbox.ColorDefault
+				bg := termbox.ColorDefault
+
+				if match < len(matches) && i >= matches[match][0] {
+					fg = termbox.ColorBlack
+					bg = termbox.ColorYellow
+					if matches[match][0] == cursorPos {
+						bg = termbox.ColorGreen
+					}
+				}
+
+				if hasSelection && i >= selStart && i < selEnd {
+					fg = termbox.ColorBlack
+					bg = termbox.ColorCyan
+				}
+
+				if i == cursorPos {
+					bg = termbox.ColorWhite
+					fg = termbox.ColorBlack
+				}
+
+				x := pane.X + lineNumWidth + colNum - w.scrollX
+				if escaped, ok := escapedCluster(cluster); ok {
+					if fg == termbox.ColorDefault {
+						fg = termbox.ColorMagenta
+					}
+					for j, r := range escaped {
+						termbox.SetCell(x+j, pane.Y+y, r, fg, bg)
+					}
+				} else {
+					termbox.SetCell(x, pane.Y+y, cluster[0], fg, bg)
+				}
+			}
+			i += len(cluster)
+			colNum += clusterWidth
+		}
 
-	if cursorPos == len([]rune(text)) {
-		if y < visibleLines && colNum >= d.scrollX && colNum < d.scrollX+visibleCols {
-			termbox.SetCell(lineNumWidth+colNum-d.scrollX, y, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		if i == cursorPos && colNum >= w.scrollX && colNum < w.scrollX+visibleCols {
+			termbox.SetCell(pane.X+lineNumWidth+colNum-w.scrollX, pane.Y+y, ' ', termbox.ColorBlack, termbox.ColorWhite)
 		}
+		lineStart = i + 1
 	}
 }
 
 func (d *Display) renderPrompt(prompt, input string) {
-	_, height := termbox.Size()
-	promptY := height - 1
+	pane := d.focusPane
+	promptY := pane.Y + pane.Height - 1
+
+	for x := pane.X; x < pane.X+pane.Width; x++ {
+		termbox.SetCell(x, promptY, ' ', termbox.ColorDefault, termbox.ColorDefault)
+	}
 
 	fullPrompt := prompt + input
-	x := 0
+	x := pane.X
 	for _, r := range fullPrompt {
+		if x >= pane.X+pane.Width-1 {
+			break
+		}
 		termbox.SetCell(x, promptY, r, termbox.ColorWhite, termbox.ColorBlue)
 		x++
 	}
 	termbox.SetCell(x, promptY, ' ', termbox.ColorBlack, termbox.ColorWhite)
 }
 
-func (d *Display) renderStatusBar() {
-	width, height := termbox.Size()
-	statusY := height - 1
+// renderStatusBar draws the status line at the bottom of a pane. The key
+// help and messages only show on the focused window's, and the others are
+// drawn dark.
+func (d *Display) renderStatusBar(pane Pane) {
+	statusY := pane.Y + pane.Height - 1
+	w := pane.Window
+	focused := w == d.focus
+	fg, bg := termbox.ColorBlack, termbox.ColorWhite
+	if !focused {
+		fg, bg = termbox.ColorWhite, termbox.ColorBlack
+	}
 
-	fm := d.editor.GetFileManager()
+	fm := w.editor.GetFileManager()
 	filename := "[No Name]"
 	if fm.HasFile() {
 		filename = filepath.Base(fm.GetFilePath())
@@ -157,68 +292,75 @@ func (d *Display) renderStatusBar() {
 	if fm.IsDirty() {
 		modifiedIndicator = " [+]"
 	}
+	if w.editor.IsReadOnly() {
+		modifiedIndicator += " [readonly]"
+	}
+	if w.editor.HasDiskConflict() {
+		modifiedIndicator += " [changed on disk]"
+	}
 
-	cursorPos := d.editor.GetCursorPosition()
-	line, col := d.editor.GetBuffer().GetLineColumn(cursorPos)
+	cursorPos := w.cursor
+	if focused {
+		cursorPos = w.editor.GetCursorPosition()
+	}
+	line, col := w.editor.GetBuffer().GetLineColumn(cursorPos)
 
-	leftStatus := fmt.Sprintf(" %s%s | Ln %d, Col %d", filename, modifiedIndicator, line+1, col)
+	leftStatus := fmt.Sprintf(" %s%s | Ln %d, Col %d | %s | %s", filename, modifiedIndicator, line+1, col, fm.GetEncoding(), fm.GetLineEnding())
 
-	rightStatus := "Ctrl+C: Copy | Ctrl+V: Paste | Ctrl+Z: Undo | Ctrl+Y: Redo | Ctrl+S: Save | Ctrl+Q: Quit "
+	rightStatus := ""
+	if focused {
+		rightStatus = "Ctrl+C: Copy | Ctrl+V: Paste | Ctrl+Z: Undo | Ctrl+Y: Redo | Ctrl+F: Find | Ctrl+R: Replace | Ctrl+G: Grep | Ctrl+O: Open | Ctrl+B: Buffers | Ctrl+X: Windows | Ctrl+E: Command | Ctrl+S: Save | Ctrl+Q: Quit "
+		if d.message != "" {
+			rightStatus = d.message + " "
+		}
+	}
 
-	for i := 0; i < width; i++ {
-		termbox.SetCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	for i := 0; i < pane.Width; i++ {
+		termbox.SetCell(pane.X+i, statusY, ' ', fg, bg)
 	}
 
 	x := 0
 	for _, r := range leftStatus {
-		if x >= width {
+		if x >= pane.Width {
 			break
 		}
-		termbox.SetCell(x, statusY, r, termbox.ColorBlack, termbox.ColorWhite)
+		termbox.SetCell(pane.X+x, statusY, r, fg, bg)
 		x++
 	}
 
-	rightX := width - len(rightStatus)
+	rightX := pane.Width - utf8.RuneCountInString(rightStatus)
 	if rightX < x {
 		rightX = x
 	}
-	for i, r := range rightStatus {
-		if rightX+i >= width {
+	for i, r := range []rune(rightStatus) {
+		if rightX+i >= pane.Width {
 			break
 		}
-		termbox.SetCell(rightX+i, statusY, r, termbox.ColorBlack, termbox.ColorWhite)
+		termbox.SetCell(pane.X+rightX+i, statusY, r, fg, bg)
 	}
 }
 
-// TODO: Find a better way to do cursor line/col tracking, a lot of duplication.
-func (d *Display) getCursorLineCol() (int, int) {
-	cursorPos := d.editor.GetCursorPosition()
-	return d.editor.GetBuffer().GetLineColumn(cursorPos)
-}
-
-func (d *Display) adjustScrollForCursor() {
-	width, height := termbox.Size()
-	visibleLines := height - 1 // Hard code 1 line for status bar. Yes its a magic number. FUck off.
-	lineNumWidth := d.getLineNumberWidth()
-	visibleCols := width - lineNumWidth
-
-	cursorLine, cursorCol := d.getCursorLineCol()
+func (d *Display) adjustScrollForCursor(w *Window, visibleLines, visibleCols, cursorPos int) {
+	cursorLine, cursorCol := w.editor.GetBuffer().GetLineColumn(cursorPos)
 
+	// Small panes get a smaller margin, so the cursor stays in view.
 	margin := 3
+	marginY := min(margin, max((visibleLines-1)/2, 0))
+	marginX := min(margin, max((visibleCols-1)/2, 0))
 
-	if cursorLine >= d.scrollY+visibleLines-margin {
-		d.scrollY = cursorLine - visibleLines + margin + 1
+	if cursorLine >= w.scrollY+visibleLines-marginY {
+		w.scrollY = cursorLine - visibleLines + marginY + 1
 	}
 
-	if cursorLine < d.scrollY+margin {
-		d.scrollY = max(cursorLine-margin, 0)
+	if cursorLine < w.scrollY+marginY {
+		w.scrollY = max(cursorLine-marginY, 0)
 	}
 
-	if cursorCol >= d.scrollX+visibleCols-margin {
-		d.scrollX = cursorCol - visibleCols + margin + 1
+	if cursorCol >= w.scrollX+visibleCols-marginX {
+		w.scrollX = cursorCol - visibleCols + marginX + 1
 	}
 
-	if cursorCol < d.scrollX+margin {
-		d.scrollX = max(cursorCol-margin, 0)
+	if cursorCol < w.scrollX+marginX {
+		w.scrollX = max(cursorCol-marginX, 0)
 	}
 }
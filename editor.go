@@ -1,14 +1,42 @@
 package main
 
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+	"unicode"
+)
+
+// typingCoalesceTimeout is the longest pause between keystrokes that still
+// extends the current typing undo step.
+const typingCoalesceTimeout = 2 * time.Second
+
 type Editor struct {
 	buffer      *PieceTable
 	cursor      *Cursor
 	desiredCol  int
 	fileManager *FileManager
 	clipboard   Clipboard
-	undoStack   []Command
-	redoStack   []Command
-}
+	history     *UndoTree
+	group       *CompositeCommand
+	groupDepth  int
+	typing      *InsertCommand
+	lastTypedAt time.Time
+	now         func() time.Time
+	swap        *SwapFile
+	recovery    *SwapRecovery
+	watcher     FileWatcher
+	onDisk      func()
+	conflict    bool
+	readOnly    bool
+	search      *Search
+	historyErr  error
+	savedSeq    int // undo state the file matches, or -1 if none does
+}
+
+// ErrReadOnly is returned when saving or recovering a read-only buffer.
+var ErrReadOnly = errors.New("buffer is read-only")
 
 func NewEditor(text string) *Editor {
 	return &Editor{
@@ -17,27 +45,86 @@ func NewEditor(text string) *Editor {
 		desiredCol:  0,
 		fileManager: NewFileManager(),
 		clipboard:   NewClipboardManager(),
-		undoStack:   make([]Command, 0),
-		redoStack:   make([]Command, 0),
+		history:     NewUndoTree(time.Now()),
+		now:         time.Now,
 	}
 }
 
 func NewEditorFromFile(filePath string) (*Editor, error) {
+	return newEditorFromFileManager(NewFileManagerWithPath(filePath))
+}
+
+// NewEditorFromFileWithEncoding opens filePath decoded as enc rather than in
+// the encoding detected from its content.
+func NewEditorFromFileWithEncoding(filePath string, enc Encoding) (*Editor, error) {
 	fm := NewFileManagerWithPath(filePath)
-	content, err := fm.ReadFile()
+	fm.SetEncoding(enc)
+	return newEditorFromFileManager(fm)
+}
+
+func newEditorFromFileManager(fm *FileManager) (*Editor, error) {
+	filePath := fm.GetFilePath()
+	buffer, err := fm.ReadPieceTable()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Editor{
-		buffer:      NewPieceTable(content),
+	editor := &Editor{
+		buffer:      buffer,
 		cursor:      NewCursor(),
 		desiredCol:  0,
 		fileManager: fm,
 		clipboard:   NewClipboardManager(),
-		undoStack:   make([]Command, 0),
-		redoStack:   make([]Command, 0),
-	}, nil
+		history:     NewUndoTree(time.Now()),
+		now:         time.Now,
+	}
+
+	// A missing or unreadable history only means there is nothing to undo yet.
+	_ = editor.loadUndoHistory()
+	editor.savedSeq = editor.history.CurrentSeq()
+
+	hash := buffer.Hash()
+	editor.recovery = findSwapRecovery(filePath, hash)
+	editor.swap = NewSwapFile(filePath, hash)
+	if editor.recovery != nil && editor.recovery.OwnerRunning {
+		// Another instance is journaling this file; leave its swap alone.
+		editor.swap.disabled = true
+	}
+	editor.buffer.AddChangeListener(editor.swap.Record)
+
+	return editor, nil
+}
+
+// NewEditorFromReader opens an editor on text read from r, such as standard
+// input, decoded and with line breaks normalized as if it were a file. The
+// buffer has no file path until it is saved as one.
+func NewEditorFromReader(r io.Reader) (*Editor, error) {
+	return newEditorFromStream(NewFileManager(), r)
+}
+
+// NewEditorFromReaderWithEncoding is NewEditorFromReader for text in a known
+// encoding.
+func NewEditorFromReaderWithEncoding(r io.Reader, enc Encoding) (*Editor, error) {
+	fm := NewFileManager()
+	fm.SetEncoding(enc)
+	return newEditorFromStream(fm, r)
+}
+
+func newEditorFromStream(fm *FileManager, r io.Reader) (*Editor, error) {
+	content, err := fm.ReadStream(r)
+	if err != nil {
+		return nil, err
+	}
+
+	editor := NewEditor(content)
+	editor.fileManager = fm
+	return editor, nil
+}
+
+// WriteBufferTo writes the buffer to w in the encoding and line break style it
+// was read with, as when handing the edited text on to a pipeline.
+func (e *Editor) WriteBufferTo(w io.Writer) error {
+	return e.fileManager.WriteStream(w, e.buffer)
 }
 
 func (e *Editor) GetText() string {
@@ -61,6 +148,54 @@ func (e *Editor) SetCursorPosition(pos int) {
 		pos = length
 	}
 	e.cursor.SetPosition(pos)
+	e.typing = nil
+}
+
+// GoToLineColumn moves the cursor to a line and display column, both counted
+// from 0. Positions past the end of a line or of the buffer are clamped.
+func (e *Editor) GoToLineColumn(line, col int) {
+	line = max(0, min(line, e.buffer.GetLineCount()-1))
+	e.ClearSelection()
+	e.SetCursorPosition(e.buffer.GetOffsetFromLineColumn(line, max(col, 0)))
+	_, e.desiredCol = e.buffer.GetLineColumn(e.cursor.GetPosition())
+}
+
+// GoToLineRune moves the cursor to a line and a column counted in runes, as
+// compilers and grep report them, rather than in display columns. Columns
+// past the end of the line go to its end, and those inside a cluster to its
+// start.
+func (e *Editor) GoToLineRune(line, col int) {
+	line = max(0, min(line, e.buffer.GetLineCount()-1))
+	start := e.buffer.lineStart(line)
+	offset := start + max(0, min(col, e.buffer.GetLineLength(line)))
+	e.buffer.forEachGrapheme(start, offset+1, func(clusterStart int, cluster []rune) bool {
+		if clusterStart+len(cluster) > offset {
+			offset = clusterStart
+			return false
+		}
+		return true
+	})
+
+	e.ClearSelection()
+	e.SetCursorPosition(offset)
+	_, e.desiredCol = e.buffer.GetLineColumn(offset)
+}
+
+// SetReadOnly stops or allows edits to the buffer. A read-only buffer still
+// moves its cursor and selection, but typing, deleting, pasting, undo and
+// saving do nothing or fail with ErrReadOnly.
+func (e *Editor) SetReadOnly(readOnly bool) {
+	e.readOnly = readOnly
+}
+
+func (e *Editor) IsReadOnly() bool {
+	return e.readOnly
+}
+
+// editable reports whether the buffer can be changed: it is not read-only,
+// and the file it is lazily read from has not been rewritten underneath it.
+func (e *Editor) editable() bool {
+	return !e.readOnly && e.buffer.Err() == nil
 }
 
 func (e *Editor) MoveCursorLeft() {
@@ -83,7 +218,8 @@ func (e *Editor) moveCursorLeft(withSelection bool) {
 	if withSelection && !e.cursor.HasSelection() {
 		e.cursor.StartSelection()
 	}
-	e.cursor.MoveLeft()
+	e.cursor.SetPosition(e.buffer.PrevGraphemeBoundary(e.cursor.GetPosition()))
+	e.typing = nil
 	_, col := e.buffer.GetLineColumn(e.cursor.GetPosition())
 	e.desiredCol = col
 }
@@ -92,7 +228,8 @@ func (e *Editor) moveCursorRight(withSelection bool) {
 	if withSelection && !e.cursor.HasSelection() {
 		e.cursor.StartSelection()
 	}
-	e.cursor.MoveRight(e.buffer.Length())
+	e.cursor.SetPosition(e.buffer.NextGraphemeBoundary(e.cursor.GetPosition()))
+	e.typing = nil
 	_, col := e.buffer.GetLineColumn(e.cursor.GetPosition())
 	e.desiredCol = col
 }
@@ -125,6 +262,7 @@ func (e *Editor) moveCursorVertical(direction int, withSelection bool) {
 	if withSelection && !e.cursor.HasSelection() {
 		e.cursor.StartSelection()
 	}
+	e.typing = nil
 
 	pos := e.cursor.GetPosition()
 	line, col := e.buffer.GetLineColumn(pos)
@@ -148,13 +286,7 @@ func (e *Editor) moveCursorVertical(direction int, withSelection bool) {
 		return
 	}
 
-	targetCol := e.desiredCol
-	lineLength := e.buffer.GetLineLength(targetLine)
-	if targetCol > lineLength {
-		targetCol = lineLength
-	}
-
-	newPos := e.buffer.GetOffsetFromLineColumn(targetLine, targetCol)
+	newPos := e.buffer.GetOffsetFromLineColumn(targetLine, e.desiredCol)
 	e.cursor.SetPosition(newPos)
 }
 
@@ -190,22 +322,94 @@ func (e *Editor) Paste() error {
 		return nil
 	}
 
-	e.InsertAtCursor(text)
+	e.InsertAtCursor(normalizeLineEndings(text))
 	return nil
 }
 
 func (e *Editor) InsertAtCursor(text string) {
+	e.insertAtCursor(text)
+}
+
+func (e *Editor) insertAtCursor(text string) *InsertCommand {
+	e.BeginGroup()
+	defer e.EndGroup()
+
 	if e.cursor.HasSelection() {
-		start, end := e.cursor.GetSelection()
-		length := end - start
-		deleteCmd := NewDeleteCommand(e.buffer, e.cursor, start, length)
-		e.executeCommand(deleteCmd)
-		e.cursor.ClearSelection()
+		e.deleteSelection()
 	}
 
 	pos := e.cursor.GetPosition()
 	cmd := NewInsertCommand(e.buffer, e.cursor, text, pos)
 	e.executeCommand(cmd)
+	return cmd
+}
+
+// TypeAtCursor inserts text typed by the user. Consecutive keystrokes are
+// merged into one undo step until the cursor moves, the user pauses, or a new
+// word starts after whitespace.
+func (e *Editor) TypeAtCursor(text string) {
+	if !e.editable() {
+		return
+	}
+	now := e.now()
+	if e.canExtendTyping(text, now) {
+		e.typing.Append(text)
+		e.history.Touch(now)
+		e.lastTypedAt = now
+		e.fileManager.MarkDirty()
+		return
+	}
+
+	e.typing = e.insertAtCursor(text)
+	e.lastTypedAt = now
+}
+
+func (e *Editor) canExtendTyping(text string, now time.Time) bool {
+	if e.typing == nil || e.cursor.HasSelection() || text == "" {
+		return false
+	}
+	if e.cursor.GetPosition() != e.typing.end() {
+		return false
+	}
+	if now.Sub(e.lastTypedAt) > typingCoalesceTimeout {
+		return false
+	}
+
+	typed := []rune(e.typing.text)
+	last := typed[len(typed)-1]
+	next := []rune(text)[0]
+	return !unicode.IsSpace(last) || unicode.IsSpace(next)
+}
+
+// BeginGroup starts collecting edits into a single undo step. Groups nest, and
+// only the outermost EndGroup records the step. A group holding one edit is
+// recorded as that edit.
+func (e *Editor) BeginGroup() {
+	if e.groupDepth == 0 {
+		e.group = NewCompositeCommand()
+	}
+	e.groupDepth++
+}
+
+func (e *Editor) EndGroup() {
+	if e.groupDepth == 0 {
+		return
+	}
+
+	e.groupDepth--
+	if e.groupDepth > 0 {
+		return
+	}
+
+	group := e.group
+	e.group = nil
+	switch group.Len() {
+	case 0:
+	case 1:
+		e.history.Push(group.commands[0], e.now())
+	default:
+		e.history.Push(group, e.now())
+	}
 }
 
 func (e *Editor) DeleteAtCursor(length int) {
@@ -225,7 +429,8 @@ func (e *Editor) Backspace() {
 
 	pos := e.cursor.GetPosition()
 	if pos > 0 {
-		cmd := NewDeleteCommand(e.buffer, e.cursor, pos-1, 1)
+		start := e.buffer.PrevGraphemeBoundary(pos)
+		cmd := NewDeleteCommand(e.buffer, e.cursor, start, pos-start)
 		e.executeCommand(cmd)
 	}
 }
@@ -238,7 +443,8 @@ func (e *Editor) Delete() {
 
 	pos := e.cursor.GetPosition()
 	if pos < e.buffer.Length() {
-		cmd := NewDeleteCommand(e.buffer, e.cursor, pos, 1)
+		end := e.buffer.NextGraphemeBoundary(pos)
+		cmd := NewDeleteCommand(e.buffer, e.cursor, pos, end-pos)
 		e.executeCommand(cmd)
 	}
 }
@@ -247,33 +453,437 @@ func (e *Editor) GetFileManager() *FileManager {
 	return e.fileManager
 }
 
+// Save writes the buffer to its file. It fails with ErrChangedOnDisk if the
+// file was modified by something else since it was opened or last saved; use
+// OverwriteSave or ReloadFromDisk to resolve that.
 func (e *Editor) Save() error {
-	return e.fileManager.WriteFile(e.buffer.String())
+	return e.save(e.fileManager.WriteFrom)
+}
+
+// OverwriteSave writes the buffer even if the file changed on disk.
+func (e *Editor) OverwriteSave() error {
+	return e.save(e.fileManager.OverwriteFrom)
+}
+
+// save streams the buffer through write, so even a large file is saved
+// without building it into one string.
+func (e *Editor) save(write func(io.WriterTo) error) error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	err := write(e.buffer)
+	if err != nil {
+		return err
+	}
+	e.markSaved()
+	e.conflict = false
+
+	hash := e.buffer.Hash()
+	if e.swap == nil {
+		e.swap = NewSwapFile(e.fileManager.GetFilePath(), hash)
+		e.buffer.AddChangeListener(e.swap.Record)
+	} else if err := e.swap.Reset(hash); err != nil {
+		return err
+	}
+	// The file is saved by now, so failing to cache its undo history does
+	// not fail the save; UndoHistoryError reports it.
+	e.historyErr = e.saveUndoHistory()
+	return nil
+}
+
+// UndoHistoryError returns why the undo history could not be kept with the
+// last save, or nil if it was. The file itself was saved either way.
+func (e *Editor) UndoHistoryError() error {
+	return e.historyErr
 }
 
 func (e *Editor) SaveAs(filePath string) error {
+	moved := filePath != e.fileManager.GetFilePath()
+	if e.swap != nil && moved {
+		if err := e.swap.Remove(); err != nil {
+			return err
+		}
+		e.swap.SetFilePath(filePath)
+	}
 	e.fileManager.SetFilePath(filePath)
-	return e.fileManager.WriteFile(e.buffer.String())
+	if err := e.Save(); err != nil {
+		return err
+	}
+
+	if moved && e.onDisk != nil {
+		e.WatchFile(e.onDisk)
+	}
+	return nil
+}
+
+// WatchFile calls onChange, from another goroutine, whenever the file may
+// have been changed by another program. The caller should then run CheckDisk
+// on its own goroutine.
+func (e *Editor) WatchFile(onChange func()) {
+	e.stopWatching()
+	e.onDisk = onChange
+	if !e.fileManager.HasFile() {
+		return
+	}
+
+	watcher := NewFileWatcher(e.fileManager.GetFilePath())
+	e.watcher = watcher
+	go func() {
+		for range watcher.Events() {
+			onChange()
+		}
+	}()
+}
+
+func (e *Editor) stopWatching() {
+	if e.watcher != nil {
+		e.watcher.Close()
+		e.watcher = nil
+	}
+}
+
+// CheckDisk looks for changes made to the file by other programs. A clean
+// buffer is reloaded; a dirty one is flagged as conflicting until it is saved
+// or reloaded. It returns a notice for the status bar, or "" when nothing
+// changed.
+func (e *Editor) CheckDisk() (string, error) {
+	changed, err := e.fileManager.ChangedOnDisk()
+	if err != nil || !changed {
+		return "", err
+	}
+
+	if e.fileManager.IsDirty() {
+		if e.conflict {
+			return "", nil
+		}
+		e.conflict = true
+		return "File changed on disk", nil
+	}
+
+	if err := e.ReloadFromDisk(); err != nil {
+		e.conflict = true
+		return "", err
+	}
+	return "Reloaded, file changed on disk", nil
+}
+
+// HasDiskConflict reports whether the file changed on disk while the buffer
+// had unsaved edits.
+func (e *Editor) HasDiskConflict() bool {
+	return e.conflict
+}
+
+// ReloadFromDisk replaces the buffer with the file's current content as one
+// undo step and marks it clean. Only the changed region is replaced, so the
+// cursor follows its text when it is outside that region and keeps its line
+// and column when it is inside.
+func (e *Editor) ReloadFromDisk() error {
+	updated, err := e.fileManager.ReadPieceTable()
+	if err != nil {
+		return err
+	}
+	if e.buffer.Err() != nil {
+		return e.resetFromDisk(updated)
+	}
+	defer updated.Close()
+
+	oldLength, newLength := e.buffer.Length(), updated.Length()
+	prefix := 0
+	for a, b := e.buffer.RuneIterator(0), updated.RuneIterator(0); prefix < oldLength && prefix < newLength; prefix++ {
+		ra, _ := a.Next()
+		rb, _ := b.Next()
+		if ra != rb {
+			break
+		}
+	}
+	suffix := 0
+	for a, b := e.buffer.RuneIterator(oldLength), updated.RuneIterator(newLength); suffix < oldLength-prefix && suffix < newLength-prefix; suffix++ {
+		ra, _ := a.Prev()
+		rb, _ := b.Prev()
+		if ra != rb {
+			break
+		}
+	}
+
+	// A read-only buffer still follows its file.
+	readOnly := e.readOnly
+	e.readOnly = false
+	defer func() { e.readOnly = readOnly }()
+
+	cursor := e.cursor.GetPosition()
+	cursorLine, cursorCol := e.buffer.GetLineColumn(cursor)
+	insideChange := cursor > prefix && cursor < oldLength-suffix
+	if cursor >= oldLength-suffix {
+		cursor += newLength - oldLength
+	}
+
+	e.cursor.ClearSelection()
+	e.BeginGroup()
+	if removed := oldLength - suffix - prefix; removed > 0 {
+		e.executeCommand(NewDeleteCommand(e.buffer, e.cursor, prefix, removed))
+	}
+	if inserted := updated.Substring(prefix, newLength-suffix); inserted != "" {
+		e.executeCommand(NewInsertCommand(e.buffer, e.cursor, inserted, prefix))
+	}
+	e.EndGroup()
+	if insideChange {
+		cursor = e.buffer.GetOffsetFromLineColumn(min(cursorLine, e.buffer.GetLineCount()-1), cursorCol)
+	}
+	e.SetCursorPosition(cursor)
+	_, e.desiredCol = e.buffer.GetLineColumn(e.cursor.GetPosition())
+
+	e.markSaved()
+	e.conflict = false
+	if e.swap != nil {
+		return e.swap.Reset(updated.Hash())
+	}
+	return nil
+}
+
+// resetFromDisk makes updated the buffer when the old text was lazily read
+// from a file since rewritten in place. That text can't be read to find what
+// changed, nor brought back by undo, so the undo history starts over.
+func (e *Editor) resetFromDisk(updated *PieceTable) error {
+	line, col := e.buffer.GetLineColumn(e.cursor.GetPosition())
+	e.buffer.reset(updated)
+	e.history = NewUndoTree(e.now())
+
+	e.GoToLineColumn(line, col)
+
+	e.markSaved()
+	e.conflict = false
+	if e.swap != nil {
+		return e.swap.Reset(e.buffer.Hash())
+	}
+	return nil
+}
+
+// SetLineEnding changes the line break style the file is saved with. The
+// buffer itself is unchanged, but the file will be, so it is marked dirty.
+func (e *Editor) SetLineEnding(le LineEnding) {
+	if le == e.fileManager.GetLineEnding() {
+		return
+	}
+	e.fileManager.SetLineEnding(le)
+	e.savedSeq = -1
+	e.fileManager.MarkDirty()
+}
+
+// markSaved records that the file now matches the current undo state. The
+// typing step is ended, so further typing can't change the saved state.
+func (e *Editor) markSaved() {
+	e.typing = nil
+	e.savedSeq = e.history.CurrentSeq()
+	e.fileManager.MarkClean()
+}
+
+// updateDirty marks the buffer clean when undo or redo has returned it to
+// the saved state, and dirty when it has left it, as Vim does.
+func (e *Editor) updateDirty() {
+	if e.history.CurrentSeq() == e.savedSeq {
+		e.fileManager.MarkClean()
+	} else {
+		e.fileManager.MarkDirty()
+	}
+}
+
+// ReopenWithEncoding reads the file again using enc instead of the detected
+// encoding, replacing the buffer as one undo step.
+func (e *Editor) ReopenWithEncoding(enc Encoding) error {
+	e.fileManager.SetEncoding(enc)
+	return e.ReloadFromDisk()
+}
+
+// SaveWithEncoding converts the file to enc and saves it. The old encoding is
+// kept if the text cannot be represented in the new one.
+func (e *Editor) SaveWithEncoding(enc Encoding) error {
+	previous := e.fileManager.GetEncoding()
+	e.fileManager.SetEncoding(enc)
+	if err := e.Save(); err != nil {
+		e.fileManager.SetEncoding(previous)
+		return err
+	}
+	return nil
+}
+
+// SyncSwap journals edits made since the last sync to the swap file.
+func (e *Editor) SyncSwap() error {
+	if e.swap == nil {
+		return nil
+	}
+	return e.swap.Sync(e.cursor.GetPosition())
+}
+
+// Close stops watching the file, releases a lazily loaded buffer and removes
+// the swap file when the editor is quit normally.
+func (e *Editor) Close() error {
+	e.stopWatching()
+	e.buffer.Close()
+	if e.swap == nil {
+		return nil
+	}
+	return e.swap.Remove()
+}
+
+// PendingSwapRecovery returns the swap file found when the file was opened,
+// until it is recovered or discarded.
+func (e *Editor) PendingSwapRecovery() *SwapRecovery {
+	return e.recovery
+}
+
+// RecoverSwap replays the edits journaled in the swap file as a single undo
+// step, leaving the buffer dirty.
+func (e *Editor) RecoverSwap() error {
+	if e.recovery == nil {
+		return errors.New("no swap file to recover")
+	}
+	if e.recovery.Err != nil {
+		return e.recovery.Err
+	}
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	if err := e.buffer.Err(); err != nil {
+		return err
+	}
+
+	recovery := e.recovery
+	e.recovery = nil
+
+	e.cursor.ClearSelection()
+	e.BeginGroup()
+	for _, edit := range recovery.edits {
+		if edit.Deleted > 0 {
+			e.executeCommand(NewDeleteCommand(e.buffer, e.cursor, edit.Offset, edit.Deleted))
+		}
+		if edit.Inserted != "" {
+			e.executeCommand(NewInsertCommand(e.buffer, e.cursor, edit.Inserted, edit.Offset))
+		}
+	}
+	e.EndGroup()
+	e.SetCursorPosition(recovery.Cursor)
+	return nil
+}
+
+// DiscardSwap forgets the swap file found at startup and deletes it, unless
+// it belongs to another running instance.
+func (e *Editor) DiscardSwap() error {
+	recovery := e.recovery
+	e.recovery = nil
+	if recovery == nil || recovery.OwnerRunning {
+		return nil
+	}
+	err := os.Remove(recovery.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SwapDiff summarises how the recovered text differs from the buffer.
+func (e *Editor) SwapDiff() string {
+	if e.recovery == nil {
+		return ""
+	}
+	if e.recovery.Err != nil {
+		return e.recovery.Err.Error()
+	}
+	recovered := e.buffer.clone()
+	for _, edit := range e.recovery.edits {
+		recovered.Delete(edit.Offset, edit.Deleted)
+		recovered.Insert(edit.Offset, edit.Inserted)
+	}
+	return summarizeDiff(e.buffer, recovered)
 }
 
 func (e *Editor) Undo() {
-	if cmd := e.popStack(&e.undoStack); cmd != nil {
+	if !e.editable() {
+		return
+	}
+	e.typing = nil
+	if cmd := e.history.Undo(); cmd != nil {
 		cmd.Undo()
-		e.redoStack = append(e.redoStack, cmd)
+		e.updateDirty()
 	}
 }
 
 func (e *Editor) Redo() {
-	if cmd := e.popStack(&e.redoStack); cmd != nil {
+	if !e.editable() {
+		return
+	}
+	e.typing = nil
+	if cmd := e.history.Redo(); cmd != nil {
+		cmd.Execute()
+		e.updateDirty()
+	}
+}
+
+// GoToUndoState moves the buffer to the undo state numbered seq, undoing and
+// redoing across branches as needed.
+func (e *Editor) GoToUndoState(seq int) bool {
+	// Path moves the tree's current state, so it must not be taken unless
+	// the buffer is about to follow.
+	if !e.editable() {
+		return false
+	}
+	undo, redo, ok := e.history.Path(seq)
+	if !ok {
+		return false
+	}
+
+	e.typing = nil
+	for _, cmd := range undo {
+		cmd.Undo()
+	}
+	for _, cmd := range redo {
 		cmd.Execute()
-		e.undoStack = append(e.undoStack, cmd)
 	}
+	e.updateDirty()
+	return true
+}
+
+// EarlierSteps moves back through undo states in the order they were created,
+// crossing branches, like Vim's g-.
+func (e *Editor) EarlierSteps(steps int) {
+	e.GoToUndoState(max(e.history.CurrentSeq()-steps, 0))
+}
+
+// LaterSteps moves forward through undo states in creation order, like Vim's
+// g+.
+func (e *Editor) LaterSteps(steps int) {
+	e.GoToUndoState(min(e.history.CurrentSeq()+steps, e.history.LastSeq()))
+}
+
+// Earlier returns the buffer to the state it was in d before the current
+// state was recorded.
+func (e *Editor) Earlier(d time.Duration) {
+	e.GoToUndoState(e.history.SeqAt(e.history.CurrentTime().Add(-d)))
+}
+
+func (e *Editor) Later(d time.Duration) {
+	e.GoToUndoState(e.history.SeqAt(e.history.CurrentTime().Add(d)))
+}
+
+// SwitchUndoBranch picks which branch Redo follows from the current state.
+func (e *Editor) SwitchUndoBranch(delta int) bool {
+	return e.history.SwitchBranch(delta)
+}
+
+func (e *Editor) UndoHistory() []UndoState {
+	return e.history.States()
 }
 
 func (e *Editor) executeCommand(cmd Command) {
+	if !e.editable() {
+		return
+	}
 	cmd.Execute()
-	e.undoStack = append(e.undoStack, cmd)
-	e.redoStack = make([]Command, 0)
+	e.typing = nil
+	if e.group != nil {
+		e.group.Add(cmd)
+	} else {
+		e.history.Push(cmd, e.now())
+	}
 	e.fileManager.MarkDirty()
 }
 
@@ -284,13 +894,3 @@ func (e *Editor) deleteSelection() {
 	e.executeCommand(cmd)
 	e.cursor.ClearSelection()
 }
-
-func (e *Editor) popStack(stack *[]Command) Command {
-	if len(*stack) == 0 {
-		return nil
-	}
-	lastIndex := len(*stack) - 1
-	cmd := (*stack)[lastIndex]
-	*stack = (*stack)[:lastIndex]
-	return cmd
-}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecuteEditorCommand runs a line typed at the command prompt against the
+// editor and returns a message for the status bar.
+func ExecuteEditorCommand(editor *Editor, input string) (string, error) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "undo":
+		if len(args) == 0 {
+			editor.Undo()
+			return "", nil
+		}
+		seq, err := strconv.Atoi(args[0])
+		if err != nil || !editor.GoToUndoState(seq) {
+			return "", fmt.Errorf("no undo state %q", args[0])
+		}
+		return fmt.Sprintf("Undo state %d", seq), nil
+	case "redo":
+		editor.Redo()
+		return "", nil
+	case "earlier", "later":
+		return moveThroughUndoHistory(editor, name == "earlier", args)
+	case "branch":
+		delta := 1
+		if len(args) > 0 && args[0] == "prev" {
+			delta = -1
+		}
+		if !editor.SwitchUndoBranch(delta) {
+			return "", errors.New("no other branch here")
+		}
+		return "Switched redo branch", nil
+	case "undolist":
+		return formatUndoList(editor.UndoHistory()), nil
+	case "lineending":
+		if len(args) == 0 {
+			return "Line endings: " + editor.GetFileManager().GetLineEnding().String(), nil
+		}
+		le, err := ParseLineEnding(args[0])
+		if err != nil {
+			return "", err
+		}
+		editor.SetLineEnding(le)
+		return "Line endings: " + le.String(), nil
+	case "encoding":
+		return "Encoding: " + editor.GetFileManager().GetEncoding().String(), nil
+	case "reopen", "save":
+		if len(args) == 0 {
+			return "", fmt.Errorf("usage: %s <encoding>", name)
+		}
+		enc, err := ParseEncoding(strings.Join(args, " "))
+		if err != nil {
+			return "", err
+		}
+		if name == "reopen" {
+			err = editor.ReopenWithEncoding(enc)
+		} else {
+			err = editor.SaveWithEncoding(enc)
+		}
+		if err != nil {
+			return "", err
+		}
+		return "Encoding: " + enc.String(), nil
+	case "reload":
+		if err := editor.ReloadFromDisk(); err != nil {
+			return "", err
+		}
+		return "Reloaded from disk", nil
+	default:
+		return "", fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// moveThroughUndoHistory handles "earlier" and "later". A bare count moves by
+// undo states; a count with an s, m, h or d suffix moves by time.
+func moveThroughUndoHistory(editor *Editor, earlier bool, args []string) (string, error) {
+	arg := "1"
+	if len(args) > 0 {
+		arg = args[0]
+	}
+
+	if steps, err := strconv.Atoi(arg); err == nil {
+		if earlier {
+			editor.EarlierSteps(steps)
+		} else {
+			editor.LaterSteps(steps)
+		}
+		return fmt.Sprintf("Undo state %d", editor.history.CurrentSeq()), nil
+	}
+
+	d, err := parseUndoDuration(arg)
+	if err != nil {
+		return "", err
+	}
+	if earlier {
+		editor.Earlier(d)
+	} else {
+		editor.Later(d)
+	}
+	return fmt.Sprintf("Undo state %d", editor.history.CurrentSeq()), nil
+}
+
+func parseUndoDuration(arg string) (time.Duration, error) {
+	if count, ok := strings.CutSuffix(arg, "d"); ok {
+		days, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", arg)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", arg)
+	}
+	return d, nil
+}
+
+// formatUndoList summarises the undo tree like Vim's :undolist, listing each
+// branch tip with its number of changes and when it was made.
+func formatUndoList(states []UndoState) string {
+	current := 0
+	var leaves []string
+	for _, state := range states {
+		if state.Current {
+			current = state.Seq
+		}
+		if state.Branches == 0 && state.Seq > 0 {
+			leaves = append(leaves, fmt.Sprintf("%d (%d changes, %s)", state.Seq, state.Changes, state.Time.Format("15:04:05")))
+		}
+	}
+
+	if len(leaves) == 0 {
+		return "No undo history"
+	}
+	return fmt.Sprintf("At %d | %s", current, strings.Join(leaves, ", "))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteEditorCommand_UndoAndRedo(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("Hello")
+
+	if _, err := ExecuteEditorCommand(editor, "undo"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "" {
+		t.Errorf("Expected empty text, got '%s'", editor.GetText())
+	}
+
+	if _, err := ExecuteEditorCommand(editor, "redo"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "Hello" {
+		t.Errorf("Expected 'Hello', got '%s'", editor.GetText())
+	}
+}
+
+func TestExecuteEditorCommand_UndoToState(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("a")
+	editor.InsertAtCursor("b")
+
+	if _, err := ExecuteEditorCommand(editor, "undo 1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "a" {
+		t.Errorf("Expected 'a', got '%s'", editor.GetText())
+	}
+
+	if _, err := ExecuteEditorCommand(editor, "undo 9"); err == nil {
+		t.Error("Expected error for missing undo state")
+	}
+}
+
+func TestExecuteEditorCommand_EarlierWithDuration(t *testing.T) {
+	editor := NewEditor("")
+	now, advance := newTestClock()
+	editor.now = now
+
+	editor.InsertAtCursor("a")
+	advance(10 * time.Minute)
+	editor.InsertAtCursor("b")
+
+	if _, err := ExecuteEditorCommand(editor, "earlier 5m"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "a" {
+		t.Errorf("Expected 'a', got '%s'", editor.GetText())
+	}
+
+	if _, err := ExecuteEditorCommand(editor, "later 1d"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "ab" {
+		t.Errorf("Expected 'ab', got '%s'", editor.GetText())
+	}
+
+	if _, err := ExecuteEditorCommand(editor, "earlier soon"); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+func TestExecuteEditorCommand_UndoList(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("a")
+	editor.Undo()
+	editor.InsertAtCursor("b")
+
+	message, err := ExecuteEditorCommand(editor, "undolist")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(message, "At 2 | 1 (1 changes") || !strings.Contains(message, "2 (1 changes") {
+		t.Errorf("Unexpected undo list %q", message)
+	}
+}
+
+func TestExecuteEditorCommand_UnknownCommand(t *testing.T) {
+	editor := NewEditor("")
+
+	if _, err := ExecuteEditorCommand(editor, "frobnicate"); err == nil {
+		t.Error("Expected error for unknown command")
+	}
+}
+
+func TestExecuteEditorCommand_LineEnding(t *testing.T) {
+	editor := NewEditor("a\nb")
+
+	message, err := ExecuteEditorCommand(editor, "lineending crlf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message != "Line endings: CRLF" {
+		t.Errorf("Unexpected message %q", message)
+	}
+	if editor.GetFileManager().GetLineEnding() != CRLF {
+		t.Errorf("Expected CRLF, got %v", editor.GetFileManager().GetLineEnding())
+	}
+	if !editor.GetFileManager().IsDirty() {
+		t.Error("Expected converting line endings to mark the buffer dirty")
+	}
+
+	if _, err := ExecuteEditorCommand(editor, "lineending nope"); err == nil {
+		t.Error("Expected an error for an unknown line ending")
+	}
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEditor_NewEditor_CreatesObjectWithInitialText(t *testing.T) {
@@ -431,6 +436,76 @@ func TestEditor_DeleteMarksFileDirty(t *testing.T) {
 	}
 }
 
+func TestEditor_Save_ChangedOnDisk_RefusesUntilOverwrite(t *testing.T) {
+	tmpFile := t.TempDir() + "/test.txt"
+	if err := writeTestFile(tmpFile, "Initial"); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(tmpFile)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	editor.InsertAtCursor("Mine: ")
+	if err := writeTestFile(tmpFile, "Rewritten by a formatter"); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	if err := editor.Save(); !errors.Is(err, ErrChangedOnDisk) {
+		t.Fatalf("Expected ErrChangedOnDisk, got %v", err)
+	}
+	if !editor.GetFileManager().IsDirty() {
+		t.Error("Expected buffer to stay dirty after a refused save")
+	}
+
+	if err := editor.OverwriteSave(); err != nil {
+		t.Fatalf("OverwriteSave failed: %v", err)
+	}
+	if got := readTestFile(t, tmpFile); got != "Mine: Initial" {
+		t.Errorf("Expected overwritten content, got %q", got)
+	}
+}
+
+func TestEditor_ReloadFromDisk_KeepsCursor(t *testing.T) {
+	tmpFile := t.TempDir() + "/test.txt"
+	if err := writeTestFile(tmpFile, "one\ntwo\nthree"); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(tmpFile)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	editor.SetCursorPosition(9) // "three", after the "t"
+	editor.InsertAtCursor("x")
+	if err := writeTestFile(tmpFile, "zero\none\ntwo\nthree"); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	if err := editor.ReloadFromDisk(); err != nil {
+		t.Fatalf("ReloadFromDisk failed: %v", err)
+	}
+	if editor.GetText() != "zero\none\ntwo\nthree" {
+		t.Errorf("Expected disk content, got %q", editor.GetText())
+	}
+	if editor.GetFileManager().IsDirty() {
+		t.Error("Expected buffer to be clean after reload")
+	}
+	line, col := editor.GetBuffer().GetLineColumn(editor.GetCursorPosition())
+	if line != 3 || col != 1 {
+		t.Errorf("Expected cursor at line 3, col 1, got line %d, col %d", line, col)
+	}
+
+	editor.Undo()
+	if editor.GetText() != "one\ntwo\ntxhree" {
+		t.Errorf("Expected reload to undo in one step, got %q", editor.GetText())
+	}
+
+	if err := editor.Save(); err != nil {
+		t.Errorf("Expected save after reload to succeed, got %v", err)
+	}
+}
+
 func writeTestFile(path, content string) error {
 	return writeFile(path, content)
 }
@@ -457,18 +532,18 @@ func TestEditor_InsertAtCursor_PushesToUndoStack(t *testing.T) {
 	editor := NewEditor("Hello")
 	editor.SetCursorPosition(5)
 
-	if len(editor.undoStack) != 0 {
-		t.Errorf("Expected empty undo stack, got length %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
 	}
 
 	editor.InsertAtCursor(" World")
 
-	if len(editor.undoStack) != 1 {
-		t.Errorf("Expected undo stack length 1, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
 	}
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("Expected empty redo stack, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -478,8 +553,8 @@ func TestEditor_MultipleInserts_BuildsUndoStack(t *testing.T) {
 	editor.InsertAtCursor("H")
 	editor.InsertAtCursor("i")
 
-	if len(editor.undoStack) != 2 {
-		t.Errorf("Expected undo stack length 2, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 2 {
+		t.Errorf("Expected undo count 2, got %d", editor.history.UndoCount())
 	}
 
 	if editor.GetText() != "Hi" {
@@ -493,8 +568,8 @@ func TestEditor_Backspace_PushesToUndoStack(t *testing.T) {
 
 	editor.Backspace()
 
-	if len(editor.undoStack) != 1 {
-		t.Errorf("Expected undo stack length 1, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
 	}
 
 	if editor.GetText() != "Hell" {
@@ -508,8 +583,8 @@ func TestEditor_Delete_PushesToUndoStack(t *testing.T) {
 
 	editor.Delete()
 
-	if len(editor.undoStack) != 1 {
-		t.Errorf("Expected undo stack length 1, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
 	}
 
 	if editor.GetText() != "ello" {
@@ -521,19 +596,18 @@ func TestEditor_NewOperation_ClearsRedoStack(t *testing.T) {
 	editor := NewEditor("Hello")
 	editor.SetCursorPosition(5)
 
-	// Simulate redo stack having content
-	cmd := NewInsertCommand(editor.buffer, editor.cursor, "test", 0)
-	editor.redoStack = append(editor.redoStack, cmd)
+	editor.InsertAtCursor("test")
+	editor.Undo()
 
-	if len(editor.redoStack) != 1 {
-		t.Errorf("Setup: Expected redo stack length 1, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 1 {
+		t.Errorf("Setup: Expected redo count 1, got %d", editor.history.RedoCount())
 	}
 
-	// New operation should clear redo stack
+	// New operation starts a new branch with nothing to redo
 	editor.InsertAtCursor("!")
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("Expected redo stack cleared, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -543,8 +617,8 @@ func TestEditor_DeleteAtCursor_PushesToUndoStack(t *testing.T) {
 
 	editor.DeleteAtCursor(5)
 
-	if len(editor.undoStack) != 1 {
-		t.Errorf("Expected undo stack length 1, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
 	}
 
 	if editor.GetText() != "Hello " {
@@ -561,8 +635,8 @@ func TestEditor_Undo_EmptyStack(t *testing.T) {
 		t.Errorf("Expected 'Hello', got '%s'", editor.GetText())
 	}
 
-	if len(editor.undoStack) != 0 {
-		t.Errorf("Expected empty undo stack, got length %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
 	}
 }
 
@@ -585,12 +659,12 @@ func TestEditor_Undo_SingleInsert(t *testing.T) {
 		t.Errorf("After undo: Expected cursor at 5, got %d", editor.GetCursorPosition())
 	}
 
-	if len(editor.undoStack) != 0 {
-		t.Errorf("Expected empty undo stack, got length %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
 	}
 
-	if len(editor.redoStack) != 1 {
-		t.Errorf("Expected redo stack length 1, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 1 {
+		t.Errorf("Expected redo count 1, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -657,12 +731,12 @@ func TestEditor_Undo_MultipleInserts(t *testing.T) {
 		t.Errorf("After 2nd undo: Expected 'Hel', got '%s'", editor.GetText())
 	}
 
-	if len(editor.undoStack) != 3 {
-		t.Errorf("Expected undo stack length 3, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 3 {
+		t.Errorf("Expected undo count 3, got %d", editor.history.UndoCount())
 	}
 
-	if len(editor.redoStack) != 2 {
-		t.Errorf("Expected redo stack length 2, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 2 {
+		t.Errorf("Expected redo count 2, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -711,12 +785,12 @@ func TestEditor_Undo_AllOperations(t *testing.T) {
 		t.Errorf("Expected empty text, got '%s'", editor.GetText())
 	}
 
-	if len(editor.undoStack) != 0 {
-		t.Errorf("Expected empty undo stack, got length %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
 	}
 
-	if len(editor.redoStack) != 3 {
-		t.Errorf("Expected redo stack length 3, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 3 {
+		t.Errorf("Expected redo count 3, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -746,8 +820,8 @@ func TestEditor_Redo_EmptyStack(t *testing.T) {
 		t.Errorf("Expected 'Hello', got '%s'", editor.GetText())
 	}
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("Expected empty redo stack, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -771,12 +845,12 @@ func TestEditor_Redo_SingleInsert(t *testing.T) {
 		t.Errorf("After redo: Expected cursor at 11, got %d", editor.GetCursorPosition())
 	}
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("Expected empty redo stack, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 
-	if len(editor.undoStack) != 1 {
-		t.Errorf("Expected undo stack length 1, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
 	}
 }
 
@@ -828,12 +902,12 @@ func TestEditor_Redo_MultipleOperations(t *testing.T) {
 		t.Errorf("After 2nd redo: Expected 'Hell', got '%s'", editor.GetText())
 	}
 
-	if len(editor.redoStack) != 1 {
-		t.Errorf("Expected redo stack length 1, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 1 {
+		t.Errorf("Expected redo count 1, got %d", editor.history.RedoCount())
 	}
 
-	if len(editor.undoStack) != 4 {
-		t.Errorf("Expected undo stack length 4, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 4 {
+		t.Errorf("Expected undo count 4, got %d", editor.history.UndoCount())
 	}
 }
 
@@ -891,12 +965,12 @@ func TestEditor_Redo_AllOperations(t *testing.T) {
 		t.Errorf("After redos: Expected 'abc', got '%s'", editor.GetText())
 	}
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("Expected empty redo stack, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 
-	if len(editor.undoStack) != 3 {
-		t.Errorf("Expected undo stack length 3, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 3 {
+		t.Errorf("Expected undo count 3, got %d", editor.history.UndoCount())
 	}
 }
 
@@ -907,14 +981,14 @@ func TestEditor_Redo_ClearedByNewOperation(t *testing.T) {
 	editor.InsertAtCursor(" World")
 	editor.Undo()
 
-	if len(editor.redoStack) != 1 {
-		t.Errorf("Before new op: Expected redo stack length 1, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 1 {
+		t.Errorf("Before new op: Expected redo count 1, got %d", editor.history.RedoCount())
 	}
 
 	editor.InsertAtCursor("!")
 
-	if len(editor.redoStack) != 0 {
-		t.Errorf("After new op: Expected empty redo stack, got length %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 0 {
+		t.Errorf("After new op: Expected nothing to redo, got %d", editor.history.RedoCount())
 	}
 
 	if editor.GetText() != "Hello!" {
@@ -965,12 +1039,12 @@ func TestEditor_RedoAfterPartialUndo(t *testing.T) {
 		t.Errorf("After redo: Expected 'abc', got '%s'", editor.GetText())
 	}
 
-	if len(editor.undoStack) != 3 {
-		t.Errorf("Expected undo stack length 3, got %d", len(editor.undoStack))
+	if editor.history.UndoCount() != 3 {
+		t.Errorf("Expected undo count 3, got %d", editor.history.UndoCount())
 	}
 
-	if len(editor.redoStack) != 1 {
-		t.Errorf("Expected redo stack length 1, got %d", len(editor.redoStack))
+	if editor.history.RedoCount() != 1 {
+		t.Errorf("Expected redo count 1, got %d", editor.history.RedoCount())
 	}
 }
 
@@ -1355,14 +1429,12 @@ func TestEditor_InsertAtCursor_UndoReplacesSelection(t *testing.T) {
 
 	editor.Undo()
 
-	if editor.GetText() != "Hello " {
-		t.Errorf("After first undo: Expected 'Hello ', got '%s'", editor.GetText())
+	if editor.GetText() != "Hello World" {
+		t.Errorf("After undo: Expected 'Hello World', got '%s'", editor.GetText())
 	}
 
-	editor.Undo()
-
-	if editor.GetText() != "Hello World" {
-		t.Errorf("After second undo: Expected 'Hello World', got '%s'", editor.GetText())
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
 	}
 }
 
@@ -1572,3 +1644,545 @@ func TestEditor_Paste_MultilineText(t *testing.T) {
 		t.Errorf("Expected '%s', got '%s'", expected, editor.GetText())
 	}
 }
+
+func TestEditor_MoveCursorRight_MovesOverGraphemeCluster(t *testing.T) {
+	editor := NewEditor("e\u0301a")
+	editor.MoveCursorRight()
+
+	if editor.GetCursorPosition() != 2 {
+		t.Errorf("Expected cursor at 2, got %d", editor.GetCursorPosition())
+	}
+
+	editor.MoveCursorLeft()
+	if editor.GetCursorPosition() != 0 {
+		t.Errorf("Expected cursor at 0, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_Backspace_DeletesWholeGraphemeCluster(t *testing.T) {
+	editor := NewEditor("a🇬🇧")
+	editor.SetCursorPosition(3)
+	editor.Backspace()
+
+	if editor.GetText() != "a" {
+		t.Errorf("Expected 'a', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 1 {
+		t.Errorf("Expected cursor at 1, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_Delete_DeletesWholeGraphemeCluster(t *testing.T) {
+	editor := NewEditor("👩‍💻b")
+	editor.Delete()
+
+	if editor.GetText() != "b" {
+		t.Errorf("Expected 'b', got %q", editor.GetText())
+	}
+}
+
+func TestEditor_MoveCursorRightWithSelection_SelectsWholeCluster(t *testing.T) {
+	editor := NewEditor("e\u0301a")
+	editor.MoveCursorRightWithSelection()
+
+	start, end := editor.GetSelection()
+	if start != 0 || end != 2 {
+		t.Errorf("Expected selection (0, 2), got (%d, %d)", start, end)
+	}
+}
+
+func TestEditor_MoveCursorDown_KeepsDisplayColumnAcrossWideCharacters(t *testing.T) {
+	editor := NewEditor("abcd\n日本")
+	editor.SetCursorPosition(2)
+	editor.MoveCursorDown()
+
+	if editor.GetCursorPosition() != 6 {
+		t.Errorf("Expected cursor at 6, got %d", editor.GetCursorPosition())
+	}
+
+	editor.MoveCursorUp()
+	if editor.GetCursorPosition() != 2 {
+		t.Errorf("Expected cursor at 2, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_InsertAtCursor_MultiByteMovesCursorByRunes(t *testing.T) {
+	editor := NewEditor("ab")
+	editor.SetCursorPosition(1)
+	editor.InsertAtCursor("é")
+	editor.InsertAtCursor("日本")
+
+	if editor.GetText() != "aé日本b" {
+		t.Errorf("Expected 'aé日本b', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 4 {
+		t.Errorf("Expected cursor at 4, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_Undo_MultiByteInsert(t *testing.T) {
+	editor := NewEditor("ab")
+	editor.SetCursorPosition(1)
+	editor.InsertAtCursor("日本")
+
+	editor.Undo()
+
+	if editor.GetText() != "ab" {
+		t.Errorf("Expected 'ab', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 1 {
+		t.Errorf("Expected cursor at 1, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_Redo_MultiByteInsert(t *testing.T) {
+	editor := NewEditor("ab")
+	editor.SetCursorPosition(2)
+	editor.InsertAtCursor("é")
+	editor.InsertAtCursor("🌍")
+
+	editor.Undo()
+	editor.Undo()
+	editor.Redo()
+	editor.Redo()
+
+	if editor.GetText() != "abé🌍" {
+		t.Errorf("Expected 'abé🌍', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 4 {
+		t.Errorf("Expected cursor at 4, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_Paste_MultiByteText(t *testing.T) {
+	editor := NewEditor("Hello !")
+	editor.clipboard = &MockClipboard{content: "世界"}
+	editor.SetCursorPosition(6)
+
+	err := editor.Paste()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if editor.GetText() != "Hello 世界!" {
+		t.Errorf("Expected 'Hello 世界!', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 8 {
+		t.Errorf("Expected cursor at 8, got %d", editor.GetCursorPosition())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "Hello !" {
+		t.Errorf("After undo, expected 'Hello !', got %q", editor.GetText())
+	}
+}
+
+func TestEditor_Backspace_AfterMultiByteInsert(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("日")
+	editor.InsertAtCursor("本")
+	editor.Backspace()
+
+	if editor.GetText() != "日" {
+		t.Errorf("Expected '日', got %q", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 1 {
+		t.Errorf("Expected cursor at 1, got %d", editor.GetCursorPosition())
+	}
+}
+
+func newTestClock() (func() time.Time, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestEditor_TypeAtCursor_CoalescesWord(t *testing.T) {
+	editor := NewEditor("")
+	editor.now, _ = newTestClock()
+
+	for _, ch := range "Hello" {
+		editor.TypeAtCursor(string(ch))
+	}
+
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "" {
+		t.Errorf("Expected empty text, got '%s'", editor.GetText())
+	}
+
+	editor.Redo()
+
+	if editor.GetText() != "Hello" {
+		t.Errorf("After redo: Expected 'Hello', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_TypeAtCursor_BreaksAtWordBoundary(t *testing.T) {
+	editor := NewEditor("")
+	editor.now, _ = newTestClock()
+
+	for _, ch := range "Hello World" {
+		editor.TypeAtCursor(string(ch))
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "Hello " {
+		t.Errorf("Expected 'Hello ', got '%s'", editor.GetText())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "" {
+		t.Errorf("Expected empty text, got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_TypeAtCursor_BreaksAfterPause(t *testing.T) {
+	editor := NewEditor("")
+	now, advance := newTestClock()
+	editor.now = now
+
+	editor.TypeAtCursor("a")
+	editor.TypeAtCursor("b")
+	advance(typingCoalesceTimeout + time.Second)
+	editor.TypeAtCursor("c")
+
+	editor.Undo()
+
+	if editor.GetText() != "ab" {
+		t.Errorf("Expected 'ab', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_TypeAtCursor_BreaksOnCursorMove(t *testing.T) {
+	editor := NewEditor("")
+	editor.now, _ = newTestClock()
+
+	editor.TypeAtCursor("a")
+	editor.TypeAtCursor("b")
+	editor.MoveCursorLeft()
+	editor.MoveCursorRight()
+	editor.TypeAtCursor("c")
+
+	if editor.history.UndoCount() != 2 {
+		t.Errorf("Expected undo count 2, got %d", editor.history.UndoCount())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "ab" {
+		t.Errorf("Expected 'ab', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_TypeAtCursor_ReplacesSelectionInOneStep(t *testing.T) {
+	editor := NewEditor("Hello World")
+	editor.now, _ = newTestClock()
+	editor.SetCursorPosition(6)
+	for i := 0; i < 5; i++ {
+		editor.MoveCursorRightWithSelection()
+	}
+
+	editor.TypeAtCursor("G")
+	editor.TypeAtCursor("o")
+
+	if editor.GetText() != "Hello Go" {
+		t.Errorf("Expected 'Hello Go', got '%s'", editor.GetText())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "Hello World" {
+		t.Errorf("Expected 'Hello World', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_BeginGroup_UndoesGroupAsOneStep(t *testing.T) {
+	editor := NewEditor("abc")
+	editor.SetCursorPosition(3)
+
+	editor.BeginGroup()
+	editor.InsertAtCursor("d")
+	editor.BeginGroup()
+	editor.Backspace()
+	editor.Backspace()
+	editor.EndGroup()
+	editor.InsertAtCursor("x")
+	editor.EndGroup()
+
+	if editor.GetText() != "abx" {
+		t.Errorf("Expected 'abx', got '%s'", editor.GetText())
+	}
+
+	if editor.history.UndoCount() != 1 {
+		t.Errorf("Expected undo count 1, got %d", editor.history.UndoCount())
+	}
+
+	editor.Undo()
+
+	if editor.GetText() != "abc" {
+		t.Errorf("After undo: Expected 'abc', got '%s'", editor.GetText())
+	}
+
+	if editor.GetCursorPosition() != 3 {
+		t.Errorf("After undo: Expected cursor at 3, got %d", editor.GetCursorPosition())
+	}
+
+	editor.Redo()
+
+	if editor.GetText() != "abx" {
+		t.Errorf("After redo: Expected 'abx', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_EndGroup_EmptyGroupRecordsNothing(t *testing.T) {
+	editor := NewEditor("abc")
+
+	editor.BeginGroup()
+	editor.EndGroup()
+	editor.EndGroup()
+
+	if editor.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", editor.history.UndoCount())
+	}
+}
+
+func TestEditor_Undo_KeepsOldBranchAfterNewEdit(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("Hello")
+	editor.InsertAtCursor(" World")
+	editor.Undo()
+	editor.InsertAtCursor("!")
+
+	if editor.GetText() != "Hello!" {
+		t.Errorf("Expected 'Hello!', got '%s'", editor.GetText())
+	}
+
+	editor.EarlierSteps(1)
+
+	if editor.GetText() != "Hello World" {
+		t.Errorf("Expected old branch 'Hello World', got '%s'", editor.GetText())
+	}
+
+	editor.LaterSteps(1)
+
+	if editor.GetText() != "Hello!" {
+		t.Errorf("Expected 'Hello!', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_SwitchUndoBranch_RedoesOtherBranch(t *testing.T) {
+	editor := NewEditor("")
+	editor.InsertAtCursor("a")
+	editor.Undo()
+	editor.InsertAtCursor("b")
+	editor.Undo()
+
+	editor.SwitchUndoBranch(1)
+	editor.Redo()
+
+	if editor.GetText() != "a" {
+		t.Errorf("Expected 'a', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_Earlier_GoesBackInTime(t *testing.T) {
+	editor := NewEditor("")
+	now, advance := newTestClock()
+	editor.now = now
+
+	editor.InsertAtCursor("one ")
+	advance(3 * time.Minute)
+	editor.InsertAtCursor("two ")
+	advance(3 * time.Minute)
+	editor.InsertAtCursor("three")
+
+	editor.Earlier(5 * time.Minute)
+
+	if editor.GetText() != "one " {
+		t.Errorf("Expected 'one ', got '%s'", editor.GetText())
+	}
+
+	editor.Later(4 * time.Minute)
+
+	if editor.GetText() != "one two " {
+		t.Errorf("Expected 'one two ', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_GoToUndoState_InvalidState(t *testing.T) {
+	editor := NewEditor("abc")
+
+	if editor.GoToUndoState(5) {
+		t.Error("Expected missing undo state to fail")
+	}
+
+	if editor.GetText() != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_GoToUndoState_ReadOnlyKeepsState(t *testing.T) {
+	editor := NewEditor("")
+	editor.TypeAtCursor("a")
+	editor.InsertAtCursor(" b")
+
+	editor.SetReadOnly(true)
+	if editor.GoToUndoState(0) {
+		t.Error("Expected a read-only buffer to refuse moving through undo states")
+	}
+	editor.SetReadOnly(false)
+	editor.Redo()
+
+	if editor.GetText() != "a b" {
+		t.Errorf("Expected 'a b', got '%s'", editor.GetText())
+	}
+}
+
+func TestEditor_Encoding_ReopenAndSaveAs(t *testing.T) {
+	tmpFile := t.TempDir() + "/latin1.txt"
+	if err := os.WriteFile(tmpFile, []byte("caf\xE9\r\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(tmpFile)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	if editor.GetText() != "café\n" {
+		t.Errorf("Expected decoded text, got %q", editor.GetText())
+	}
+	if editor.GetFileManager().GetEncoding() != Latin1 {
+		t.Errorf("Expected ISO-8859-1, got %v", editor.GetFileManager().GetEncoding())
+	}
+
+	editor.SetCursorPosition(editor.GetBuffer().Length())
+	editor.InsertAtCursor("naïve")
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(tmpFile); string(data) != "caf\xE9\r\nna\xEFve" {
+		t.Errorf("Expected ISO-8859-1 with CRLF on disk, got %q", data)
+	}
+
+	editor.InsertAtCursor(" €")
+	if err := editor.Save(); err == nil {
+		t.Error("Expected saving € as ISO-8859-1 to fail")
+	}
+	if err := editor.SaveWithEncoding(UTF8); err != nil {
+		t.Fatalf("SaveWithEncoding failed: %v", err)
+	}
+	if data, _ := os.ReadFile(tmpFile); string(data) != "café\r\nnaïve €" {
+		t.Errorf("Expected UTF-8 on disk, got %q", data)
+	}
+
+	if err := editor.ReopenWithEncoding(Latin1); err != nil {
+		t.Fatalf("ReopenWithEncoding failed: %v", err)
+	}
+	if editor.GetText() != "cafÃ©\nnaÃ¯ve â\u0082¬" {
+		t.Errorf("Expected UTF-8 bytes read as ISO-8859-1, got %q", editor.GetText())
+	}
+}
+
+func TestEditor_NewEditorFromReader_RoundTripsToWriter(t *testing.T) {
+	editor, err := NewEditorFromReader(strings.NewReader("caf\xE9\r\nline\r\n"))
+	if err != nil {
+		t.Fatalf("NewEditorFromReader failed: %v", err)
+	}
+	if editor.GetText() != "café\nline\n" {
+		t.Errorf("Expected decoded text, got %q", editor.GetText())
+	}
+	if editor.GetFileManager().HasFile() {
+		t.Error("Expected no file path for piped input")
+	}
+
+	editor.SetCursorPosition(editor.GetBuffer().Length())
+	editor.InsertAtCursor("é")
+
+	var out bytes.Buffer
+	if err := editor.WriteBufferTo(&out); err != nil {
+		t.Fatalf("WriteBufferTo failed: %v", err)
+	}
+	if out.String() != "caf\xE9\r\nline\r\n\xE9" {
+		t.Errorf("Expected text in its original encoding, got %q", out.String())
+	}
+}
+
+func TestEditor_GoToLineColumn_Clamps(t *testing.T) {
+	editor := NewEditor("one\ntwo\nthree")
+
+	editor.GoToLineColumn(1, 2)
+	if editor.GetCursorPosition() != 6 {
+		t.Errorf("Expected cursor at 6, got %d", editor.GetCursorPosition())
+	}
+	editor.GoToLineColumn(1, 50)
+	if editor.GetCursorPosition() != 7 {
+		t.Errorf("Expected cursor at end of line 2, got %d", editor.GetCursorPosition())
+	}
+	editor.GoToLineColumn(99, 0)
+	if editor.GetCursorPosition() != 8 {
+		t.Errorf("Expected cursor at start of last line, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_GoToLineRune_CountsRunes(t *testing.T) {
+	editor := NewEditor("x\n日本語\tcafe\u0301!")
+
+	editor.GoToLineRune(1, 2)
+	if editor.GetCursorPosition() != 4 {
+		t.Errorf("Expected cursor on 語, got %d", editor.GetCursorPosition())
+	}
+	editor.GoToLineRune(1, 8)
+	if editor.GetCursorPosition() != 9 {
+		t.Errorf("Expected cursor at the start of é, got %d", editor.GetCursorPosition())
+	}
+	editor.GoToLineRune(1, 50)
+	if editor.GetCursorPosition() != 12 {
+		t.Errorf("Expected cursor at end of line 2, got %d", editor.GetCursorPosition())
+	}
+}
+
+func TestEditor_ReadOnly_RefusesEdits(t *testing.T) {
+	tmpFile := t.TempDir() + "/readonly.txt"
+	if err := writeTestFile(tmpFile, "Hello"); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	editor, err := NewEditorFromFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	editor.InsertAtCursor("Oh ")
+	editor.SetReadOnly(true)
+
+	editor.TypeAtCursor("x")
+	editor.Backspace()
+	editor.Delete()
+	editor.Undo()
+	if editor.GetText() != "Oh Hello" {
+		t.Errorf("Expected buffer to be unchanged, got %q", editor.GetText())
+	}
+	if err := editor.Save(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if readTestFile(t, tmpFile) != "Hello" {
+		t.Error("Expected file to be untouched")
+	}
+
+	editor.SetReadOnly(false)
+	editor.Undo()
+	if editor.GetText() != "Hello" {
+		t.Errorf("Expected undo to work again, got %q", editor.GetText())
+	}
+}
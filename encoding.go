@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of a file on disk. Buffers always hold
+// decoded text; the file's encoding is applied again when it is written.
+type Encoding int
+
+const (
+	UTF8 Encoding = iota
+	UTF8BOM
+	UTF16LE
+	UTF16LEBOM
+	UTF16BE
+	UTF16BEBOM
+	Latin1
+	Windows1252
+)
+
+var encodingNames = map[Encoding]string{
+	UTF8:        "UTF-8",
+	UTF8BOM:     "UTF-8 BOM",
+	UTF16LE:     "UTF-16LE",
+	UTF16LEBOM:  "UTF-16LE BOM",
+	UTF16BE:     "UTF-16BE",
+	UTF16BEBOM:  "UTF-16BE BOM",
+	Latin1:      "ISO-8859-1",
+	Windows1252: "Windows-1252",
+}
+
+func (enc Encoding) String() string {
+	return encodingNames[enc]
+}
+
+// ParseEncoding accepts an encoding's name or a common alias, ignoring case
+// and punctuation, so "utf8", "UTF-16le" and "cp1252" all work.
+func ParseEncoding(name string) (Encoding, error) {
+	key := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+
+	switch key {
+	case "utf8":
+		return UTF8, nil
+	case "utf8bom":
+		return UTF8BOM, nil
+	case "utf16le":
+		return UTF16LE, nil
+	case "utf16lebom", "utf16":
+		return UTF16LEBOM, nil
+	case "utf16be":
+		return UTF16BE, nil
+	case "utf16bebom":
+		return UTF16BEBOM, nil
+	case "iso88591", "latin1":
+		return Latin1, nil
+	case "windows1252", "cp1252":
+		return Windows1252, nil
+	default:
+		return UTF8, fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// windows1252High maps bytes 0x80-0x9F, where Windows-1252 differs from
+// ISO-8859-1. The five bytes it leaves undefined map to the matching C1
+// control, as browsers do, so every byte still round-trips.
+var windows1252High = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// detectEncoding guesses the encoding of data from its byte order mark, or
+// failing that from whether it is valid UTF-8 or looks like BOM-less UTF-16.
+// Anything else is treated as a single-byte Western encoding.
+func detectEncoding(data []byte) Encoding {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return UTF8BOM
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return UTF16LEBOM
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return UTF16BEBOM
+	}
+
+	if enc, ok := detectUTF16(data); ok {
+		return enc
+	}
+	if utf8.Valid(data) || looksLikeUTF8(data) {
+		return UTF8
+	}
+
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9F {
+			return Windows1252
+		}
+	}
+	return Latin1
+}
+
+// looksLikeUTF8 reports whether data that is not valid UTF-8 is still better
+// read as UTF-8 with its bad bytes escaped: binary data with NUL bytes, or
+// text whose non-ASCII characters are mostly well-formed UTF-8.
+func looksLikeUTF8(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+
+	var valid, invalid int
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case size > 1:
+			valid++
+		}
+		data = data[size:]
+	}
+	return valid > invalid
+}
+
+// detectUTF16 recognises BOM-less UTF-16 text by the zero high bytes of its
+// ASCII characters, which land on every other byte. Data that would need
+// raw-byte escapes to decode is not taken for UTF-16, so that a wrong guess
+// can't change the bytes of a file saved untouched.
+func detectUTF16(data []byte) (Encoding, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return UTF8, false
+	}
+
+	var evenZeros, oddZeros int
+	for i := 0; i < len(data); i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	units := len(data) / 2
+	var enc Encoding
+	switch {
+	case oddZeros*2 > units && evenZeros*10 < units:
+		enc = UTF16LE
+	case evenZeros*2 > units && oddZeros*10 < units:
+		enc = UTF16BE
+	default:
+		return UTF8, false
+	}
+
+	text, err := decodeUTF16(data, enc)
+	if err != nil {
+		return UTF8, false
+	}
+	for _, r := range text {
+		if _, ok := rawByteOf(r); ok {
+			return UTF8, false
+		}
+	}
+	return enc, true
+}
+
+// decodeText converts file bytes in the given encoding to text, dropping any
+// byte order mark.
+func decodeText(data []byte, enc Encoding) (string, error) {
+	switch enc {
+	case UTF8:
+		return decodeUTF8Raw(data), nil
+	case UTF8BOM:
+		return decodeUTF8Raw(bytes.TrimPrefix(data, utf8BOM)), nil
+	case UTF16LE, UTF16LEBOM, UTF16BE, UTF16BEBOM:
+		return decodeUTF16(data, enc)
+	case Latin1, Windows1252:
+		var sb strings.Builder
+		sb.Grow(len(data))
+		for _, b := range data {
+			r := rune(b)
+			if enc == Windows1252 && b >= 0x80 && b <= 0x9F {
+				r = windows1252High[b-0x80]
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %v", enc)
+	}
+}
+
+// decodeUTF16 decodes UTF-16, escaping the bytes of unpaired surrogates and
+// of a trailing odd byte so they are written back unchanged.
+func decodeUTF16(data []byte, enc Encoding) (string, error) {
+	data = bytes.TrimPrefix(data, byteOrderMark(enc))
+
+	bigEndian := isBigEndian(enc)
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(data[i])<<8 | rune(data[i+1])
+		}
+		return rune(data[i]) | rune(data[i+1])<<8
+	}
+
+	runes := make([]rune, 0, len(data)/2)
+	i := 0
+	for ; i+1 < len(data); i += 2 {
+		u := unit(i)
+		if !utf16.IsSurrogate(u) {
+			runes = append(runes, u)
+			continue
+		}
+		if i+3 < len(data) {
+			r := utf16.DecodeRune(u, unit(i+2))
+			if _, escaped := rawByteOf(r); r != utf8.RuneError && !escaped {
+				runes = append(runes, r)
+				i += 2
+				continue
+			}
+		}
+		runes = append(runes, rawByteRune(data[i]), rawByteRune(data[i+1]))
+	}
+	if i < len(data) {
+		runes = append(runes, rawByteRune(data[i]))
+	}
+	return string(runes), nil
+}
+
+// encodeText converts text to file bytes in the given encoding. The BOM
+// encodings get their byte order mark back. Characters the encoding cannot
+// represent are an error rather than being replaced.
+func encodeText(text string, enc Encoding) ([]byte, error) {
+	data := append(make([]byte, 0, len(text)+3), byteOrderMark(enc)...)
+	return appendEncoded(data, text, enc)
+}
+
+// byteOrderMark returns the bytes written at the start of a file in enc.
+func byteOrderMark(enc Encoding) []byte {
+	switch enc {
+	case UTF8BOM:
+		return utf8BOM
+	case UTF16LEBOM:
+		return utf16LEBOM
+	case UTF16BEBOM:
+		return utf16BEBOM
+	default:
+		return nil
+	}
+}
+
+func isBigEndian(enc Encoding) bool {
+	return enc == UTF16BE || enc == UTF16BEBOM
+}
+
+// appendEncoded appends text in the given encoding to data, without a byte
+// order mark.
+func appendEncoded(data []byte, text string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case UTF8, UTF8BOM:
+		return encodeUTF8Raw(data, text), nil
+	case UTF16LE, UTF16LEBOM, UTF16BE, UTF16BEBOM:
+		bigEndian := isBigEndian(enc)
+		for _, r := range text {
+			if b, ok := rawByteOf(r); ok {
+				data = append(data, b)
+				continue
+			}
+			for _, u := range utf16.AppendRune(nil, r) {
+				if bigEndian {
+					data = append(data, byte(u>>8), byte(u))
+				} else {
+					data = append(data, byte(u), byte(u>>8))
+				}
+			}
+		}
+		return data, nil
+	case Latin1, Windows1252:
+		for _, r := range text {
+			if b, ok := rawByteOf(r); ok {
+				data = append(data, b)
+				continue
+			}
+			b, ok := encodeSingleByte(r, enc)
+			if !ok {
+				return nil, fmt.Errorf("%q cannot be saved as %v", r, enc)
+			}
+			data = append(data, b)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %v", enc)
+	}
+}
+
+// textEncoder is a writer that takes UTF-8 text and writes it to w with the
+// given line ending and encoding, so a buffer can be saved as it streams out.
+// Runes split across writes are held back until they are complete. Close
+// must be called to write the byte order mark of an empty file and any
+// incomplete rune left at the end.
+type textEncoder struct {
+	w          io.Writer
+	encoding   Encoding
+	lineEnding LineEnding
+	started    bool
+	pending    []byte
+	buf        []byte
+}
+
+func newTextEncoder(w io.Writer, enc Encoding, lineEnding LineEnding) *textEncoder {
+	return &textEncoder{w: w, encoding: enc, lineEnding: lineEnding}
+}
+
+func (te *textEncoder) Write(p []byte) (int, error) {
+	data := p
+	if len(te.pending) > 0 {
+		data = append(te.pending, p...)
+	}
+	size := fullRunesPrefix(data)
+	if err := te.encode(data[:size]); err != nil {
+		return 0, err
+	}
+	te.pending = append(te.pending[:0:0], data[size:]...)
+	return len(p), nil
+}
+
+func (te *textEncoder) Close() error {
+	data := te.pending
+	te.pending = nil
+	return te.encode(data)
+}
+
+func (te *textEncoder) encode(data []byte) error {
+	te.buf = te.buf[:0]
+	if !te.started {
+		te.buf = append(te.buf, byteOrderMark(te.encoding)...)
+		te.started = true
+	}
+
+	var err error
+	te.buf, err = appendEncoded(te.buf, applyLineEnding(string(data), te.lineEnding), te.encoding)
+	if err != nil {
+		return err
+	}
+	if len(te.buf) == 0 {
+		return nil
+	}
+	_, err = te.w.Write(te.buf)
+	return err
+}
+
+func encodeSingleByte(r rune, enc Encoding) (byte, bool) {
+	if enc == Windows1252 {
+		for i, mapped := range windows1252High {
+			if mapped == r {
+				return byte(0x80 + i), true
+			}
+		}
+		if r >= 0x80 && r <= 0x9F {
+			return 0, false
+		}
+	}
+	if r > 0xFF {
+		return 0, false
+	}
+	return byte(r), true
+}
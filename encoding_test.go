@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Encoding
+	}{
+		{"ascii", []byte("hello"), UTF8},
+		{"utf-8", []byte("café"), UTF8},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFhi"), UTF8BOM},
+		{"utf-16le bom", []byte("\xFF\xFEh\x00i\x00"), UTF16LEBOM},
+		{"utf-16be bom", []byte("\xFE\xFF\x00h\x00i"), UTF16BEBOM},
+		{"utf-16le no bom", []byte("h\x00e\x00l\x00l\x00o\x00"), UTF16LE},
+		{"utf-16be no bom", []byte("\x00h\x00e\x00l\x00l\x00o"), UTF16BE},
+		{"latin-1", []byte("caf\xE9"), Latin1},
+		{"windows-1252", []byte("\x93quoted\x94"), Windows1252},
+	}
+
+	for _, tt := range tests {
+		if got := detectEncoding(tt.data); got != tt.expected {
+			t.Errorf("%s: detectEncoding = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestDecodeEncode_RoundTrip(t *testing.T) {
+	tests := []struct {
+		enc  Encoding
+		data []byte
+		text string
+	}{
+		{UTF8, []byte("café"), "café"},
+		{UTF8BOM, []byte("\xEF\xBB\xBFcafé"), "café"},
+		{UTF16LEBOM, []byte("\xFF\xFEc\x00\xE9\x00=\xD8\x00\xDE"), "cé😀"},
+		{UTF16BEBOM, []byte("\xFE\xFF\x00c\x00\xE9\xD8=\xDE\x00"), "cé😀"},
+		{UTF16LE, []byte("h\x00i\x00\n\x00"), "hi\n"},
+		{UTF16BE, []byte("\x00h\x00i\x00\n"), "hi\n"},
+		{Latin1, []byte("caf\xE9"), "café"},
+		{Windows1252, []byte("\x80 \x93hi\x94 \x81"), "€ “hi” \u0081"},
+	}
+
+	for _, tt := range tests {
+		text, err := decodeText(tt.data, tt.enc)
+		if err != nil {
+			t.Errorf("%v: decode failed: %v", tt.enc, err)
+			continue
+		}
+		if text != tt.text {
+			t.Errorf("%v: decoded %q, want %q", tt.enc, text, tt.text)
+		}
+
+		data, err := encodeText(text, tt.enc)
+		if err != nil {
+			t.Errorf("%v: encode failed: %v", tt.enc, err)
+			continue
+		}
+		if !bytes.Equal(data, tt.data) {
+			t.Errorf("%v: encoded %q, want %q", tt.enc, data, tt.data)
+		}
+	}
+}
+
+func TestEncodeText_UnrepresentableCharacter(t *testing.T) {
+	if _, err := encodeText("€", Latin1); err == nil {
+		t.Error("Expected an error saving € as ISO-8859-1")
+	}
+	if _, err := encodeText("日本", Windows1252); err == nil {
+		t.Error("Expected an error saving CJK text as Windows-1252")
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := map[string]Encoding{
+		"utf8":         UTF8,
+		"UTF-8":        UTF8,
+		"utf-8-bom":    UTF8BOM,
+		"UTF-16LE":     UTF16LE,
+		"utf16be":      UTF16BE,
+		"utf-16":       UTF16LEBOM,
+		"UTF-16BE-BOM": UTF16BEBOM,
+		"latin1":       Latin1,
+		"ISO-8859-1":   Latin1,
+		"cp1252":       Windows1252,
+		"windows-1252": Windows1252,
+	}
+	for name, expected := range tests {
+		got, err := ParseEncoding(name)
+		if err != nil || got != expected {
+			t.Errorf("ParseEncoding(%q) = %v, %v, want %v", name, got, err, expected)
+		}
+	}
+
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Error("Expected an error for an unknown encoding")
+	}
+}
+
+func TestTextEncoder_SplitRunesAndLineEndings(t *testing.T) {
+	var out bytes.Buffer
+	encoder := newTextEncoder(&out, UTF16BE, CRLF)
+
+	text := []byte("é\n€")
+	for i := range text {
+		if _, err := encoder.Write(text[i : i+1]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	expected, _ := encodeText("é\r\n€", UTF16BE)
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("Expected % x, got % x", expected, out.Bytes())
+	}
+}
+
+func TestTextEncoder_EmptyTextKeepsBOM(t *testing.T) {
+	var out bytes.Buffer
+	if err := newTextEncoder(&out, UTF8BOM, LF).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), utf8BOM) {
+		t.Errorf("Expected a lone BOM, got % x", out.Bytes())
+	}
+}
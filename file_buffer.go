@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"unicode/utf8"
+)
+
+// fileChunkSize is roughly how many bytes of a lazily loaded file are decoded
+// at a time.
+const fileChunkSize = 64 << 10
+
+// fileChunkCacheSize is how many decoded chunks a fileBuffer keeps.
+const fileChunkCacheSize = 16
+
+// ErrFileRewritten is returned for a lazily loaded buffer whose file was
+// changed in place by another program, so its text can no longer be read.
+var ErrFileRewritten = errors.New("file was rewritten while open, reload it")
+
+// errReadInMemory is returned by openFileBuffer for a file that has to be
+// read into memory after all: it has carriage returns to convert, or it
+// changed while it was being indexed.
+var errReadInMemory = errors.New("file must be read into memory")
+
+// fileChunk is one slice of a lazily loaded file. Chunks end on rune
+// boundaries, so each decodes on its own exactly as it would in place.
+type fileChunk struct {
+	byteStart    int64
+	byteLength   int
+	runeStart    int
+	lineBreakNum int // line breaks before the chunk
+}
+
+// fileBuffer is a read-only UTF-8 buffer that reads its text from the file on
+// demand instead of holding it in memory. Opening it reads the file once to
+// index where each chunk's runes and line breaks start; afterwards only the
+// chunks being looked at are decoded, a few at a time.
+//
+// Saving replaces the file with a rename, which leaves the old contents
+// readable through the open handle. Another program may rewrite it in place,
+// though, so every chunk read checks the file still has the size and
+// modification time it was indexed with. Once it has not, the buffer reads
+// nothing more from it and err is ErrFileRewritten.
+type fileBuffer struct {
+	file       *os.File
+	info       os.FileInfo
+	err        error
+	chunks     []fileChunk
+	length     int
+	lineBreaks int
+	textHash   string
+
+	cache    map[int][]rune
+	cacheAge []int
+}
+
+// openFileBuffer indexes the UTF-8 file at path, skipping skip leading bytes
+// such as a byte order mark. It also returns the hash of the raw file bytes.
+// The file is read once, and fails with errReadInMemory as soon as a
+// carriage return shows up.
+func openFileBuffer(path string, skip int64) (*fileBuffer, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	fail := func(err error) (*fileBuffer, string, error) {
+		file.Close()
+		return nil, "", err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	fb := &fileBuffer{
+		file:  file,
+		info:  info,
+		cache: make(map[int][]rune),
+	}
+
+	// The text hash is the raw hash until the text first differs from the
+	// bytes, at a byte order mark or an escaped byte. Only from there is it
+	// hashed separately, carrying on from a copy of the raw hash.
+	rawHash := sha256.New()
+	var textHash hash.Hash
+	if skip > 0 {
+		textHash = sha256.New()
+	}
+	buf := make([]byte, fileChunkSize+utf8.UTFMax)
+	pending := 0
+	pos := int64(0)
+	eof := false
+
+	for !eof {
+		n, err := io.ReadFull(file, buf[pending:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+		} else if err != nil {
+			return fail(err)
+		}
+
+		data := buf[:pending+n]
+		if pos == 0 && skip > 0 {
+			skip = min(skip, int64(len(data)))
+			rawHash.Write(data[:skip])
+			data = data[skip:]
+			pos = skip
+		}
+
+		size := len(data)
+		if !eof {
+			size = fullRunesPrefix(data)
+		}
+		chunk := data[:size]
+		if len(chunk) > 0 {
+			if bytes.IndexByte(chunk, '\r') >= 0 {
+				return fail(errReadInMemory)
+			}
+			runes := countRawRunes(chunk)
+			fb.chunks = append(fb.chunks, fileChunk{
+				byteStart:    pos,
+				byteLength:   len(chunk),
+				runeStart:    fb.length,
+				lineBreakNum: fb.lineBreaks,
+			})
+			fb.length += runes
+			fb.lineBreaks += bytes.Count(chunk, []byte{'\n'})
+
+			if textHash == nil && !decodesAsIs(chunk, runes) {
+				clone, err := rawHash.(hash.Cloner).Clone()
+				if err != nil {
+					return fail(err)
+				}
+				textHash = clone
+			}
+			rawHash.Write(chunk)
+			if textHash != nil {
+				writeTextHash(textHash, chunk, runes)
+			}
+		}
+
+		pos += int64(size)
+		pending = copy(buf, data[size:])
+	}
+
+	if after, err := file.Stat(); err != nil {
+		return fail(err)
+	} else if !sameFileState(info, after) {
+		return fail(errReadInMemory)
+	}
+
+	raw := hex.EncodeToString(rawHash.Sum(nil))
+	fb.textHash = raw
+	if textHash != nil {
+		fb.textHash = hex.EncodeToString(textHash.Sum(nil))
+	}
+	return fb, raw, nil
+}
+
+// sameFileState reports whether a file still has the size and modification
+// time it had.
+func sameFileState(before, after os.FileInfo) bool {
+	return before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+}
+
+// fullRunesPrefix returns the length of data up to the last point where a
+// rune may start, holding back a sequence the next read could complete.
+func fullRunesPrefix(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
+
+// countRawRunes counts the runes decodeUTF8Raw would produce for data.
+func countRawRunes(data []byte) int {
+	if utf8.Valid(data) && !containsRawByteRunes(data) {
+		return utf8.RuneCount(data)
+	}
+	return utf8.RuneCountInString(decodeUTF8Raw(data))
+}
+
+// decodesAsIs reports whether chunk, holding runes runes once decoded, is
+// already the UTF-8 of its text, with no bytes to escape.
+func decodesAsIs(chunk []byte, runes int) bool {
+	return runes == utf8.RuneCount(chunk) && utf8.Valid(chunk)
+}
+
+// writeTextHash adds a chunk to the hash of the decoded text, matching
+// contentHash of the whole buffer's String().
+func writeTextHash(h io.Writer, chunk []byte, runes int) {
+	if decodesAsIs(chunk, runes) {
+		h.Write(chunk)
+		return
+	}
+	io.WriteString(h, decodeUTF8Raw(chunk))
+}
+
+func (fb *fileBuffer) Len() int {
+	return fb.length
+}
+
+func (fb *fileBuffer) Close() error {
+	return fb.file.Close()
+}
+
+// check returns ErrFileRewritten once the file no longer has the size and
+// modification time it was indexed with.
+func (fb *fileBuffer) check() error {
+	if fb.err != nil {
+		return fb.err
+	}
+	info, err := fb.file.Stat()
+	switch {
+	case err != nil:
+		fb.err = err
+	case !sameFileState(fb.info, info):
+		fb.err = ErrFileRewritten
+	}
+	return fb.err
+}
+
+// chunkAt returns the index of the chunk holding rune offset.
+func (fb *fileBuffer) chunkAt(offset int) int {
+	return sort.Search(len(fb.chunks), func(i int) bool {
+		return fb.chunks[i].runeStart > offset
+	}) - 1
+}
+
+func (fb *fileBuffer) chunkLength(i int) int {
+	if i+1 < len(fb.chunks) {
+		return fb.chunks[i+1].runeStart - fb.chunks[i].runeStart
+	}
+	return fb.length - fb.chunks[i].runeStart
+}
+
+// decode returns the runes of chunk i, reading them from the file if they
+// are not cached. Once the file has been rewritten, chunks not already cached
+// are all U+FFFD rather than a mix of old offsets and new text. A short read
+// is padded the same way, so offsets stay in range.
+func (fb *fileBuffer) decode(i int) []rune {
+	if runes, ok := fb.cache[i]; ok {
+		return runes
+	}
+
+	chunk := fb.chunks[i]
+	expected := fb.chunkLength(i)
+	data := make([]byte, chunk.byteLength)
+	n, _ := fb.file.ReadAt(data, chunk.byteStart)
+	// Checking after the read means what was read predates any rewrite.
+	if fb.check() != nil {
+		return slices.Repeat([]rune{utf8.RuneError}, expected)
+	}
+	runes := []rune(decodeUTF8Raw(data[:n]))
+
+	for len(runes) < expected {
+		runes = append(runes, utf8.RuneError)
+	}
+	runes = runes[:expected]
+
+	if len(fb.cacheAge) >= fileChunkCacheSize {
+		delete(fb.cache, fb.cacheAge[0])
+		fb.cacheAge = fb.cacheAge[1:]
+	}
+	fb.cache[i] = runes
+	fb.cacheAge = append(fb.cacheAge, i)
+	return runes
+}
+
+// Runes returns the runes in [start, end). The result may share memory with
+// the cache and must not be modified.
+func (fb *fileBuffer) Runes(start, end int) []rune {
+	if start >= end {
+		return nil
+	}
+
+	i := fb.chunkAt(start)
+	chunkStart := fb.chunks[i].runeStart
+	if end-chunkStart <= fb.chunkLength(i) {
+		return fb.decode(i)[start-chunkStart : end-chunkStart]
+	}
+
+	result := make([]rune, 0, end-start)
+	for offset := start; offset < end; i++ {
+		chunkStart = fb.chunks[i].runeStart
+		runes := fb.decode(i)
+		to := min(end-chunkStart, len(runes))
+		result = append(result, runes[offset-chunkStart:to]...)
+		offset = chunkStart + to
+	}
+	return result
+}
+
+// LineBreaksBefore counts the line breaks in [0, offset).
+func (fb *fileBuffer) LineBreaksBefore(offset int) int {
+	if offset >= fb.length {
+		return fb.lineBreaks
+	}
+	if offset <= 0 {
+		return 0
+	}
+
+	i := fb.chunkAt(offset)
+	count := fb.chunks[i].lineBreakNum
+	for _, r := range fb.decode(i)[:offset-fb.chunks[i].runeStart] {
+		if r == '\n' {
+			count++
+		}
+	}
+	return count
+}
+
+// LineBreak returns the offset of the n-th (0-based) line break.
+func (fb *fileBuffer) LineBreak(n int) int {
+	i := sort.Search(len(fb.chunks), func(i int) bool {
+		return fb.chunks[i].lineBreakNum > n
+	}) - 1
+
+	remaining := n - fb.chunks[i].lineBreakNum
+	for j, r := range fb.decode(i) {
+		if r == '\n' {
+			if remaining == 0 {
+				return fb.chunks[i].runeStart + j
+			}
+			remaining--
+		}
+	}
+	return fb.length
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lazyTestData builds text several chunks long, with multibyte runes and
+// invalid bytes landing on chunk boundaries.
+func lazyTestData() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 3*fileChunkSize+100; i++ {
+		switch i % 5 {
+		case 0:
+			buf.WriteString("line with café and 日本語\n")
+		case 1:
+			buf.WriteString("emoji 😀 here\n")
+		case 2:
+			buf.WriteString("bad \xFF byte\n")
+		default:
+			buf.WriteString(strings.Repeat("x", i%37) + "\n")
+		}
+	}
+	buf.WriteString("no final newline")
+	return buf.Bytes()
+}
+
+func openLazyTestTable(t *testing.T, data []byte) (*PieceTable, *FileManager) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	threshold := lazyLoadThreshold
+	lazyLoadThreshold = 0
+	t.Cleanup(func() { lazyLoadThreshold = threshold })
+
+	fm := NewFileManagerWithPath(path)
+	pt, err := fm.ReadPieceTable()
+	if err != nil {
+		t.Fatalf("ReadPieceTable failed: %v", err)
+	}
+	t.Cleanup(func() { pt.Close() })
+	if pt.originalFile == nil {
+		t.Fatal("Expected the file to be loaded lazily")
+	}
+	return pt, fm
+}
+
+func TestFileBuffer_MatchesInMemoryTable(t *testing.T) {
+	data := lazyTestData()
+	lazy, _ := openLazyTestTable(t, data)
+	eager := NewPieceTable(decodeUTF8Raw(data))
+
+	if lazy.Length() != eager.Length() {
+		t.Fatalf("Expected length %d, got %d", eager.Length(), lazy.Length())
+	}
+	if lazy.String() != eager.String() {
+		t.Fatal("Expected the same text as an in-memory table")
+	}
+	if lazy.Hash() != eager.Hash() {
+		t.Error("Expected the indexed hash to match the text hash")
+	}
+	if lazy.GetLineCount() != eager.GetLineCount() {
+		t.Fatalf("Expected %d lines, got %d", eager.GetLineCount(), lazy.GetLineCount())
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for range 200 {
+		line := rng.Intn(eager.GetLineCount())
+		if lazy.lineStart(line) != eager.lineStart(line) {
+			t.Fatalf("Line %d: expected start %d, got %d", line, eager.lineStart(line), lazy.lineStart(line))
+		}
+		offset := rng.Intn(eager.Length() + 1)
+		lazyLine, lazyCol := lazy.GetLineColumn(offset)
+		eagerLine, eagerCol := eager.GetLineColumn(offset)
+		if lazyLine != eagerLine || lazyCol != eagerCol {
+			t.Fatalf("Offset %d: expected %d:%d, got %d:%d", offset, eagerLine, eagerCol, lazyLine, lazyCol)
+		}
+	}
+}
+
+func TestFileBuffer_Edits(t *testing.T) {
+	data := lazyTestData()
+	lazy, _ := openLazyTestTable(t, data)
+	eager := NewPieceTable(decodeUTF8Raw(data))
+
+	rng := rand.New(rand.NewSource(2))
+	for range 100 {
+		offset := rng.Intn(eager.Length() + 1)
+		if rng.Intn(2) == 0 {
+			lazy.Insert(offset, "new\ntext")
+			eager.Insert(offset, "new\ntext")
+		} else {
+			length := rng.Intn(5000)
+			lazy.Delete(offset, length)
+			eager.Delete(offset, length)
+		}
+	}
+
+	if lazy.String() != eager.String() {
+		t.Fatal("Expected the same text after the same edits")
+	}
+	if lazy.GetLineCount() != eager.GetLineCount() {
+		t.Errorf("Expected %d lines, got %d", eager.GetLineCount(), lazy.GetLineCount())
+	}
+	if lazy.Hash() != eager.Hash() {
+		t.Error("Expected Hash to match the edited text")
+	}
+}
+
+func TestFileManager_ReadPieceTable_LazySaveRoundTrip(t *testing.T) {
+	data := lazyTestData()
+	pt, fm := openLazyTestTable(t, data)
+
+	if err := fm.WriteFile(pt.String()); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	saved, err := os.ReadFile(fm.GetFilePath())
+	if err != nil {
+		t.Fatalf("Failed to read saved file: %v", err)
+	}
+	if !bytes.Equal(saved, data) {
+		t.Error("Expected an untouched lazy buffer to save the same bytes")
+	}
+
+	// The open handle still reads the replaced file's contents.
+	if pt.Substring(0, 4) != "line" {
+		t.Errorf("Expected the buffer to stay readable after saving, got %q", pt.Substring(0, 4))
+	}
+}
+
+func TestFileManager_ReadPieceTable_CRLFLoadsEagerly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dos.txt")
+	if err := os.WriteFile(path, []byte("a\r\nb\r\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	threshold := lazyLoadThreshold
+	lazyLoadThreshold = 0
+	defer func() { lazyLoadThreshold = threshold }()
+
+	fm := NewFileManagerWithPath(path)
+	pt, err := fm.ReadPieceTable()
+	if err != nil {
+		t.Fatalf("ReadPieceTable failed: %v", err)
+	}
+	if pt.originalFile != nil {
+		t.Error("Expected CRLF text to be loaded into memory for conversion")
+	}
+	if pt.String() != "a\nb\n" || fm.GetLineEnding() != CRLF {
+		t.Errorf("Expected normalized CRLF text, got %q, %v", pt.String(), fm.GetLineEnding())
+	}
+}
+
+func openLazyTestEditor(t *testing.T, data []byte) (*Editor, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	threshold := lazyLoadThreshold
+	lazyLoadThreshold = 0
+	t.Cleanup(func() { lazyLoadThreshold = threshold })
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	t.Cleanup(func() { editor.Close() })
+	if editor.GetBuffer().originalFile == nil {
+		t.Fatal("Expected the file to be loaded lazily")
+	}
+	return editor, path
+}
+
+func TestFileBuffer_RewrittenInPlace_RefusesEditsAndSaves(t *testing.T) {
+	editor, path := openLazyTestEditor(t, lazyTestData())
+	rewritten := []byte(strings.Repeat("rewritten\n", fileChunkSize/5))
+	if err := os.WriteFile(path, rewritten, 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+
+	before := editor.GetBuffer().Length()
+	editor.InsertAtCursor("x")
+	if editor.GetBuffer().Length() != before {
+		t.Error("Expected edits to be refused once the file was rewritten")
+	}
+	if err := editor.Save(); !errors.Is(err, ErrChangedOnDisk) {
+		t.Errorf("Expected ErrChangedOnDisk from Save, got %v", err)
+	}
+	if err := editor.OverwriteSave(); !errors.Is(err, ErrFileRewritten) {
+		t.Errorf("Expected ErrFileRewritten from OverwriteSave, got %v", err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !bytes.Equal(saved, rewritten) {
+		t.Error("Expected the rewritten file to be left alone")
+	}
+}
+
+func TestFileBuffer_RewrittenInPlace_ReloadCannotBeUndone(t *testing.T) {
+	editor, path := openLazyTestEditor(t, lazyTestData())
+	rewritten := strings.Repeat("rewritten\n", fileChunkSize/5)
+	if err := os.WriteFile(path, []byte(rewritten), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+
+	if _, err := editor.CheckDisk(); err != nil {
+		t.Fatalf("CheckDisk failed: %v", err)
+	}
+	if editor.GetText() != rewritten {
+		t.Fatal("Expected the buffer to be reloaded from the rewritten file")
+	}
+	if editor.GetFileManager().IsDirty() {
+		t.Error("Expected the reloaded buffer to be clean")
+	}
+
+	editor.Undo()
+	if editor.GetText() != rewritten {
+		t.Error("Expected undo to have nothing to restore")
+	}
+	editor.InsertAtCursor("x")
+	if !strings.HasPrefix(editor.GetText(), "x") {
+		t.Error("Expected the reloaded buffer to be editable")
+	}
+}
+
+func TestFileManager_ReadPieceTable_LateCRLoadsEagerly(t *testing.T) {
+	data := []byte(strings.Repeat("unix line\n", fileChunkSize/5) + "dos line\r\n")
+	path := filepath.Join(t.TempDir(), "mixed.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	threshold := lazyLoadThreshold
+	lazyLoadThreshold = 0
+	defer func() { lazyLoadThreshold = threshold }()
+
+	fm := NewFileManagerWithPath(path)
+	pt, err := fm.ReadPieceTable()
+	if err != nil {
+		t.Fatalf("ReadPieceTable failed: %v", err)
+	}
+	if pt.originalFile != nil {
+		t.Error("Expected a carriage return past the first chunk to load the file into memory")
+	}
+	if err := fm.WriteFile(pt.String()); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if saved, _ := os.ReadFile(path); !bytes.Equal(saved, data) {
+		t.Error("Expected the mixed line breaks to save unchanged")
+	}
+}
+
+func TestFileBuffer_HashSkipsByteOrderMark(t *testing.T) {
+	text := strings.Repeat("plain line\n", fileChunkSize/5)
+	lazy, fm := openLazyTestTable(t, append([]byte("\xEF\xBB\xBF"), text...))
+
+	if lazy.Hash() != contentHash(text) {
+		t.Error("Expected the hash of the text without its byte order mark")
+	}
+	// A touch makes ChangedOnDisk compare the recorded raw hash.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fm.GetFilePath(), later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	if changed, err := fm.ChangedOnDisk(); err != nil || changed {
+		t.Errorf("Expected the raw hash to match the file, got %v, %v", changed, err)
+	}
+}
@@ -1,13 +1,43 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrChangedOnDisk is returned by WriteFile when the file was modified by
+// something else since it was last read or written.
+var ErrChangedOnDisk = errors.New("file changed on disk")
+
+// diskState is what the file looked like the last time it was read or
+// written. The modification time and size are a cheap first check; the hash
+// settles whether the content really changed.
+type diskState struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
 type FileManager struct {
-	filePath string
-	isDirty  bool
+	filePath   string
+	isDirty    bool
+	disk       *diskState
+	lineEnding LineEnding
+	encoding   Encoding
+	// encodingSet stops ReadFile from guessing over an encoding the user
+	// chose.
+	encodingSet bool
 }
 
 func NewFileManager() *FileManager {
@@ -25,6 +55,9 @@ func (fm *FileManager) GetFilePath() string {
 }
 
 func (fm *FileManager) SetFilePath(path string) {
+	if path != fm.filePath {
+		fm.disk = nil
+	}
 	fm.filePath = path
 }
 
@@ -40,33 +73,395 @@ func (fm *FileManager) MarkClean() {
 	fm.isDirty = false
 }
 
+// GetLineEnding returns the line break style used when writing the file.
+func (fm *FileManager) GetLineEnding() LineEnding {
+	return fm.lineEnding
+}
+
+func (fm *FileManager) SetLineEnding(le LineEnding) {
+	fm.lineEnding = le
+}
+
+// GetEncoding returns the character encoding used when writing the file.
+func (fm *FileManager) GetEncoding() Encoding {
+	return fm.encoding
+}
+
+// SetEncoding picks the encoding for later reads and writes, overriding
+// detection.
+func (fm *FileManager) SetEncoding(enc Encoding) {
+	fm.encoding = enc
+	fm.encodingSet = true
+}
+
 func (fm *FileManager) HasFile() bool {
 	return fm.filePath != ""
 }
 
+// ReadFile returns the file's text decoded from its encoding and with its
+// line breaks normalized to '\n', remembering both for WriteFile.
 func (fm *FileManager) ReadFile() (string, error) {
 	if fm.filePath == "" {
 		return "", errors.New("no file path set")
 	}
 
+	// Stat before reading, so a write racing with the read shows up as a
+	// change later rather than being recorded as seen.
+	info, err := os.Stat(fm.filePath)
+	if err != nil {
+		return "", err
+	}
 	data, err := os.ReadFile(fm.filePath)
 	if err != nil {
 		return "", err
 	}
 
-	return string(data), nil
+	content, err := fm.decode(data)
+	if err != nil {
+		return "", err
+	}
+	fm.recordDiskState(info, contentHash(string(data)))
+	return content, nil
+}
+
+// ReadStream is ReadFile for text that does not come from the file, such as
+// standard input. The file's path and disk state are left alone.
+func (fm *FileManager) ReadStream(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return fm.decode(data)
+}
+
+// decode converts raw bytes to buffer text, detecting the encoding unless one
+// was set and remembering the line break style.
+func (fm *FileManager) decode(data []byte) (string, error) {
+	encoding := fm.encoding
+	if !fm.encodingSet {
+		encoding = detectEncoding(data)
+	}
+	content, err := decodeText(data, encoding)
+	if err != nil {
+		return "", err
+	}
+
+	fm.encoding = encoding
+	content, fm.lineEnding = splitLineEnding(content, encoding)
+	return content, nil
+}
+
+// lazyLoadThreshold is the file size from which ReadPieceTable leaves the
+// text on disk and reads it on demand. Tests lower it.
+var lazyLoadThreshold int64 = 8 << 20
+
+// ReadPieceTable reads the file into a PieceTable. Large UTF-8 files with
+// plain '\n' line breaks are not loaded into memory; their text is read from
+// the file as it is needed. Everything else goes through ReadFile.
+func (fm *FileManager) ReadPieceTable() (*PieceTable, error) {
+	if fm.filePath == "" {
+		return nil, errors.New("no file path set")
+	}
+
+	info, err := os.Stat(fm.filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() >= lazyLoadThreshold {
+		pt, err := fm.readLazily()
+		if pt != nil || err != nil {
+			return pt, err
+		}
+	}
+
+	content, err := fm.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	return NewPieceTable(content), nil
+}
+
+// readLazily opens the file as a lazily read buffer, or returns nil if it
+// needs decoding or line break conversion, or changed while being indexed.
+// The whole file is still read once to index it, but never held in memory.
+func (fm *FileManager) readLazily() (*PieceTable, error) {
+	file, err := os.Open(fm.filePath)
+	if err != nil {
+		return nil, err
+	}
+	sample := make([]byte, fileChunkSize)
+	n, err := io.ReadFull(file, sample)
+	file.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	sample = sample[:fullRunesPrefix(sample[:n])]
+
+	encoding := fm.encoding
+	if !fm.encodingSet {
+		encoding = detectEncoding(sample)
+	}
+	if encoding != UTF8 && encoding != UTF8BOM {
+		return nil, nil
+	}
+
+	skip := int64(0)
+	if encoding == UTF8BOM && bytes.HasPrefix(sample, utf8BOM) {
+		skip = int64(len(utf8BOM))
+	}
+	fb, rawHash, err := openFileBuffer(fm.filePath, skip)
+	if errors.Is(err, errReadInMemory) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fm.recordDiskState(fb.info, rawHash)
+	fm.encoding = encoding
+	fm.lineEnding = LF
+	return newPieceTableFromFile(fb), nil
 }
 
+// WriteFile saves content in the file's encoding and line break style,
+// refusing with ErrChangedOnDisk if the file was modified since it was read
+// or last written. OverwriteFile skips the check.
 func (fm *FileManager) WriteFile(content string) error {
+	return fm.WriteFrom(strings.NewReader(content))
+}
+
+func (fm *FileManager) OverwriteFile(content string) error {
+	return fm.OverwriteFrom(strings.NewReader(content))
+}
+
+// WriteFrom is WriteFile for text streamed from src, such as a PieceTable,
+// which is encoded as it is written so saving needs no copy of the document.
+func (fm *FileManager) WriteFrom(src io.WriterTo) error {
+	if fm.filePath == "" {
+		return errors.New("no file path set")
+	}
+
+	changed, err := fm.ChangedOnDisk()
+	if err != nil {
+		return err
+	}
+	if changed {
+		return ErrChangedOnDisk
+	}
+
+	return fm.OverwriteFrom(src)
+}
+
+// OverwriteFrom is OverwriteFile for text streamed from src.
+func (fm *FileManager) OverwriteFrom(src io.WriterTo) error {
 	if fm.filePath == "" {
 		return errors.New("no file path set")
 	}
 
-	err := os.WriteFile(fm.filePath, []byte(content), 0644)
+	h := sha256.New()
+	err := writeFileAtomicFrom(fm.filePath, func(w io.Writer) error {
+		return fm.WriteStream(io.MultiWriter(w, h), src)
+	})
 	if err != nil {
 		return err
 	}
 
+	info, err := os.Stat(fm.filePath)
+	if err != nil {
+		return err
+	}
+	fm.recordDiskState(info, hex.EncodeToString(h.Sum(nil)))
 	fm.MarkClean()
 	return nil
 }
+
+// WriteStream writes the text from src to w in the file's encoding and line
+// break style, without touching the file itself.
+func (fm *FileManager) WriteStream(w io.Writer, src io.WriterTo) error {
+	encoder := newTextEncoder(w, fm.encoding, fm.lineEnding)
+	if _, err := src.WriteTo(encoder); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// ChangedOnDisk reports whether the file differs from what was last read or
+// written. A file that was never read or written has nothing to compare
+// against and is never reported as changed.
+func (fm *FileManager) ChangedOnDisk() (bool, error) {
+	if fm.disk == nil {
+		return false, nil
+	}
+
+	info, err := os.Stat(fm.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(fm.disk.modTime) && info.Size() == fm.disk.size {
+		return false, nil
+	}
+
+	hash, err := hashFile(fm.filePath)
+	if err != nil {
+		return false, err
+	}
+	if hash != fm.disk.hash {
+		return true, nil
+	}
+
+	// Touched but not changed, so remember the new time to skip rehashing.
+	fm.disk.modTime = info.ModTime()
+	fm.disk.size = info.Size()
+	return false, nil
+}
+
+func (fm *FileManager) recordDiskState(info os.FileInfo, hash string) {
+	fm.disk = &diskState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    hash,
+	}
+}
+
+// hashFile returns the SHA-256 of a file's bytes, read in a stream.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFileAtomic replaces the file at path without ever leaving it partly
+// written: the data goes to a temporary file in the same directory, is synced,
+// and is then renamed over the original. Symlinks are followed so the link
+// itself survives, and an existing file keeps its permissions and, where the
+// platform allows, its owner.
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileAtomicFrom(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomicFrom is writeFileAtomic for data produced by write, which is
+// buffered into the temporary file rather than held in memory.
+func writeFileAtomicFrom(path string, write func(io.Writer) error) error {
+	target, err := resolveSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	dir, base := filepath.Split(target)
+	tmp, err := createTemp(dir, "."+base+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	buffered := bufio.NewWriter(tmp)
+	if err := write(buffered); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	// A new file keeps the mode it was created with, which honours the
+	// umask; an existing one keeps its own.
+	if info != nil {
+		preserveOwner(tmp, info)
+		if err := tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return err
+	}
+	committed = true
+
+	syncDir(filepath.Dir(target))
+	return nil
+}
+
+// maxSymlinks bounds how many links resolveSymlinks follows, as the kernel
+// does, so a loop of links fails instead of hanging.
+const maxSymlinks = 40
+
+// resolveSymlinks returns the file that path names after following symlinks.
+// A link whose target does not exist yet resolves to that target, so saving
+// creates the file behind the link instead of replacing the link.
+func resolveSymlinks(path string) (string, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return target, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	for range maxSymlinks {
+		link, err := os.Readlink(path)
+		if err != nil {
+			// Not a link, or missing: path is the file to create.
+			return path, nil
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+}
+
+// createTemp creates a new file in dir named prefix and a random suffix. It
+// asks for mode 0666 like os.Create, so the umask decides the mode of a new
+// file; os.CreateTemp would always make it 0600.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+	}
+	return nil, fmt.Errorf("%s: could not create a temporary file", dir)
+}
+
+// syncDir flushes a directory entry after a rename. Not every platform can
+// open a directory for syncing, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestFileManager_NewFileManager(t *testing.T) {
@@ -165,3 +168,378 @@ func TestFileManager_ReadWriteRoundTrip(t *testing.T) {
 		t.Errorf("Round-trip failed. Expected %q, got %q", originalContent, readContent)
 	}
 }
+
+func TestFileManager_WriteFile_PreservesPermissions(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(tmpFile, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Chmod(tmpFile, 0750); err != nil {
+		t.Fatalf("Failed to chmod test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	if err := fm.WriteFile("new"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	info, err := os.Stat(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to stat written file: %v", err)
+	}
+
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("Expected mode 0750, got %o", info.Mode().Perm())
+	}
+}
+
+func TestFileManager_WriteFile_NewFileDefaultPermissions(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "new.txt")
+
+	fm := NewFileManagerWithPath(tmpFile)
+	if err := fm.WriteFile("content"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	info, err := os.Stat(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to stat written file: %v", err)
+	}
+
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %o", info.Mode().Perm())
+	}
+}
+
+func TestFileManager_WriteFile_FollowsSymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "target.txt")
+	link := filepath.Join(tmpDir, "link.txt")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(link)
+	if err := fm.WriteFile("new"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatalf("Failed to lstat link: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected link to still be a symlink")
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read target: %v", err)
+	}
+	if string(content) != "new" {
+		t.Errorf("Expected target content 'new', got %q", string(content))
+	}
+}
+
+func TestFileManager_WriteFile_CreatesTargetOfDanglingSymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "missing.txt")
+	link := filepath.Join(tmpDir, "link.txt")
+	if err := os.Symlink("missing.txt", link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(link)
+	if err := fm.WriteFile("new"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatalf("Failed to lstat link: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected link to still be a symlink")
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read target: %v", err)
+	}
+	if string(content) != "new" {
+		t.Errorf("Expected target content 'new', got %q", string(content))
+	}
+}
+
+func TestFileManager_WriteFile_LeavesNoTemporaryFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.txt")
+
+	fm := NewFileManagerWithPath(tmpFile)
+	for i := 0; i < 3; i++ {
+		if err := fm.WriteFile("content"); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the written file, got %d entries", len(entries))
+	}
+}
+
+func TestFileManager_WriteFile_TargetIsDirectory_KeepsDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dirPath := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(dirPath)
+	if err := fm.WriteFile("content"); err == nil {
+		t.Error("Expected error when writing over a directory")
+	}
+
+	info, err := os.Stat(dirPath)
+	if err != nil || !info.IsDir() {
+		t.Error("Expected directory to be left in place")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected temporary file to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestFileManager_WriteFile_RefusesWhenChangedOnDisk(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(tmpFile, []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	if _, err := fm.ReadFile(); err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if err := os.WriteFile(tmpFile, []byte("changed elsewhere"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	if err := fm.WriteFile("mine"); !errors.Is(err, ErrChangedOnDisk) {
+		t.Fatalf("Expected ErrChangedOnDisk, got %v", err)
+	}
+	if got := readTestFile(t, tmpFile); got != "changed elsewhere" {
+		t.Errorf("Expected file to be left alone, got %q", got)
+	}
+
+	if err := fm.OverwriteFile("mine"); err != nil {
+		t.Fatalf("OverwriteFile failed: %v", err)
+	}
+	if err := fm.WriteFile("mine again"); err != nil {
+		t.Errorf("Expected WriteFile to succeed after overwriting, got %v", err)
+	}
+}
+
+func TestFileManager_ChangedOnDisk_IgnoresTouchWithoutChange(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(tmpFile, []byte("same"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	if _, err := fm.ReadFile(); err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(tmpFile, later, later); err != nil {
+		t.Fatalf("Failed to touch test file: %v", err)
+	}
+
+	changed, err := fm.ChangedOnDisk()
+	if err != nil {
+		t.Fatalf("ChangedOnDisk failed: %v", err)
+	}
+	if changed {
+		t.Error("Expected a touched but unchanged file to not count as changed")
+	}
+}
+
+func TestFileManager_ChangedOnDisk_DeletedFile(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(tmpFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	if _, err := fm.ReadFile(); err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if err := os.Remove(tmpFile); err != nil {
+		t.Fatalf("Failed to remove test file: %v", err)
+	}
+
+	changed, err := fm.ChangedOnDisk()
+	if err != nil {
+		t.Fatalf("ChangedOnDisk failed: %v", err)
+	}
+	if !changed {
+		t.Error("Expected a deleted file to count as changed")
+	}
+
+	fm.SetFilePath(filepath.Join(filepath.Dir(tmpFile), "other.txt"))
+	if err := fm.WriteFile("content"); err != nil {
+		t.Errorf("Expected a new path to have nothing to compare against, got %v", err)
+	}
+}
+
+func TestFileManager_ReadWrite_PreservesCRLF(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "dos.txt")
+	if err := os.WriteFile(tmpFile, []byte("one\r\ntwo\r\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	content, err := fm.ReadFile()
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if content != "one\ntwo\n" {
+		t.Errorf("Expected normalized content, got %q", content)
+	}
+	if fm.GetLineEnding() != CRLF {
+		t.Errorf("Expected CRLF, got %v", fm.GetLineEnding())
+	}
+
+	if err := fm.WriteFile(content + "three\n"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read written file: %v", err)
+	}
+	if string(data) != "one\r\ntwo\r\nthree\r\n" {
+		t.Errorf("Expected CRLF to be restored, got %q", data)
+	}
+}
+
+func TestFileManager_ReadWrite_CRLFWithStrayLF(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "mostly-dos.txt")
+	original := []byte("one\r\ntwo\nthree\r\nfour\r\n")
+	if err := os.WriteFile(tmpFile, original, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fm := NewFileManagerWithPath(tmpFile)
+	content, err := fm.ReadFile()
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if fm.GetLineEnding() != CRLF {
+		t.Errorf("Expected CRLF, got %v", fm.GetLineEnding())
+	}
+	if pt := NewPieceTable(content); pt.GetLineLength(0) != 3 {
+		t.Errorf("Expected the CRLF lines to be normalized, got %q", content)
+	}
+
+	if err := fm.WriteFile(content); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read written file: %v", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Errorf("Expected the stray LF to be kept, got %q", data)
+	}
+}
+
+func TestFileManager_ReadWrite_BOMlessUTF16StaysBOMless(t *testing.T) {
+	tests := []struct {
+		enc  Encoding
+		data []byte
+	}{
+		{UTF16LE, []byte("h\x00i\x00\n\x00")},
+		{UTF16BE, []byte("\x00h\x00i\x00\n")},
+	}
+
+	for _, tt := range tests {
+		tmpFile := filepath.Join(t.TempDir(), "wide.txt")
+		if err := os.WriteFile(tmpFile, tt.data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		fm := NewFileManagerWithPath(tmpFile)
+		content, err := fm.ReadFile()
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if fm.GetEncoding() != tt.enc {
+			t.Errorf("Expected %v, got %v", tt.enc, fm.GetEncoding())
+		}
+		if err := fm.WriteFile(content); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		data, err := os.ReadFile(tmpFile)
+		if err != nil {
+			t.Fatalf("Failed to read written file: %v", err)
+		}
+		if !bytes.Equal(data, tt.data) {
+			t.Errorf("%v: expected % x, got % x", tt.enc, tt.data, data)
+		}
+	}
+}
+
+func TestFileManager_WriteFrom_StreamsPieceTable(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "stream.txt")
+	fm := NewFileManagerWithPath(tmpFile)
+	fm.SetLineEnding(CRLF)
+
+	pt := NewPieceTable("one\ntwo")
+	pt.Insert(3, "\nand a half")
+	if err := fm.WriteFrom(pt); err != nil {
+		t.Fatalf("WriteFrom failed: %v", err)
+	}
+
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read written file: %v", err)
+	}
+	if string(data) != "one\r\nand a half\r\ntwo" {
+		t.Errorf("Expected streamed CRLF text, got %q", data)
+	}
+	if changed, err := fm.ChangedOnDisk(); err != nil || changed {
+		t.Errorf("Expected written file to match its recorded hash, got %v, %v", changed, err)
+	}
+}
+
+func TestFileManager_WriteFrom_UnencodableLeavesFile(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "latin.txt")
+	if err := os.WriteFile(tmpFile, []byte("caf\xe9"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	fm := NewFileManagerWithPath(tmpFile)
+	if _, err := fm.ReadFile(); err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	if err := fm.WriteFrom(NewPieceTable("café €")); err == nil {
+		t.Fatal("Expected an error saving € as ISO-8859-1")
+	}
+	data, _ := os.ReadFile(tmpFile)
+	if string(data) != "caf\xe9" {
+		t.Errorf("Expected file to be untouched, got %q", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(tmpFile))
+	if len(entries) != 1 {
+		t.Errorf("Expected temporary file to be removed, got %d entries", len(entries))
+	}
+}
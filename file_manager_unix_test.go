@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFileManager_WriteFile_NewFileHonoursUmask(t *testing.T) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	tmpFile := filepath.Join(t.TempDir(), "new.txt")
+	fm := NewFileManagerWithPath(tmpFile)
+	if err := fm.WriteFile("content"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	info, err := os.Stat(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to stat written file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 under umask 077, got %o", info.Mode().Perm())
+	}
+}
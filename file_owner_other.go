@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// preserveOwner is a no-op where files have no Unix owner.
+func preserveOwner(file *os.File, info os.FileInfo) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives file the owner and group recorded in info. Only root
+// can give files away, so failures are ignored.
+func preserveOwner(file *os.File, info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	file.Chown(int(stat.Uid), int(stat.Gid))
+}
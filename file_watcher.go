@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often the polling watcher stats the file when the
+// platform has no native change notifications.
+const pollInterval = time.Second
+
+// FileWatcher reports on Events whenever the watched file may have changed.
+// Events are coalesced, so one receive can stand for several changes, and
+// callers should check the file themselves rather than trust every event.
+// Events is closed once the watcher is closed.
+type FileWatcher interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// NewFileWatcher watches path with the platform's change notifications,
+// falling back to polling where those are unavailable. Symlinks are followed
+// so edits to the target are seen.
+func NewFileWatcher(path string) FileWatcher {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	watcher, err := newNativeWatcher(path)
+	if err != nil {
+		return newPollWatcher(path, pollInterval)
+	}
+	return watcher
+}
+
+// notifyChange queues an event unless one is already waiting.
+func notifyChange(events chan struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
+
+type pollWatcher struct {
+	path   string
+	events chan struct{}
+	done   chan struct{}
+}
+
+func newPollWatcher(path string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		path:   path,
+		events: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	last, lastErr := os.Stat(path)
+	go w.run(interval, last, lastErr)
+	return w
+}
+
+func (w *pollWatcher) run(interval time.Duration, last os.FileInfo, lastErr error) {
+	defer close(w.events)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(w.path)
+		switch {
+		case (err == nil) != (lastErr == nil):
+			notifyChange(w.events)
+		case err == nil && (!info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size()):
+			notifyChange(w.events)
+		}
+		last, lastErr = info, err
+	}
+}
+
+func (w *pollWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
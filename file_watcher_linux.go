@@ -0,0 +1,78 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyWatcher watches the directory holding the file rather than the file
+// itself, because saving with a rename replaces the inode an inotify watch on
+// the file would be attached to.
+type inotifyWatcher struct {
+	file   *os.File
+	name   string
+	events chan struct{}
+}
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+func newNativeWatcher(path string) (FileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// wakes the reader goroutine.
+	w := &inotifyWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		name:   name,
+		events: make(chan struct{}, 1),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *inotifyWatcher) run() {
+	defer close(w.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := buf[nameStart : nameStart+int(event.Len)]
+			if string(bytes.TrimRight(name, "\x00")) == w.name || event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				notifyChange(w.events)
+			}
+			offset = nameStart + int(event.Len)
+		}
+	}
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
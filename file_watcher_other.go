@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newNativeWatcher has no implementation here, so NewFileWatcher polls.
+func newNativeWatcher(path string) (FileWatcher, error) {
+	return nil, errors.New("file change notifications not supported")
+}
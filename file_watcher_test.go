@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForChange(t *testing.T, watcher FileWatcher) {
+	t.Helper()
+	select {
+	case <-watcher.Events():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for a change event")
+	}
+}
+
+func TestFileWatcher_SeesAtomicSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	watcher := NewFileWatcher(path)
+	defer watcher.Close()
+
+	if err := writeFileAtomic(path, []byte("two")); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	waitForChange(t, watcher)
+}
+
+func TestFileWatcher_IgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched.txt")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	watcher, err := newNativeWatcher(path)
+	if err != nil {
+		t.Skip("No native change notifications on this platform")
+	}
+	defer watcher.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	select {
+	case <-watcher.Events():
+		t.Error("Expected no event for another file in the directory")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPollWatcher_SeesWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	watcher := newPollWatcher(path, 10*time.Millisecond)
+	defer watcher.Close()
+
+	if err := os.WriteFile(path, []byte("longer"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	waitForChange(t, watcher)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	waitForChange(t, watcher)
+}
+
+func TestFileWatcher_CloseEndsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	watchers := []FileWatcher{NewFileWatcher(path), newPollWatcher(path, 10*time.Millisecond)}
+	for _, watcher := range watchers {
+		watcher.Close()
+		// A change queued before the close may still be received first.
+		deadline := time.After(3 * time.Second)
+		for open := true; open; {
+			select {
+			case _, open = <-watcher.Events():
+			case <-deadline:
+				t.Errorf("Expected %T to close its events when closed", watcher)
+				open = false
+			}
+		}
+	}
+}
+
+func TestEditor_CheckDisk_ReloadsCleanBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := os.WriteFile(path, []byte("line 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("line 1\nline 2\n"), 0644); err != nil {
+		t.Fatalf("Failed to append to file: %v", err)
+	}
+
+	message, err := editor.CheckDisk()
+	if err != nil {
+		t.Fatalf("CheckDisk failed: %v", err)
+	}
+	if message == "" {
+		t.Error("Expected a notice about the reload")
+	}
+	if editor.GetText() != "line 1\nline 2\n" {
+		t.Errorf("Expected reloaded text, got %q", editor.GetText())
+	}
+	if editor.HasDiskConflict() || editor.GetFileManager().IsDirty() {
+		t.Error("Expected a clean buffer without conflict after reload")
+	}
+
+	message, err = editor.CheckDisk()
+	if err != nil || message != "" {
+		t.Errorf("Expected nothing to report without changes, got %q, %v", message, err)
+	}
+}
+
+func TestEditor_CheckDisk_FlagsConflictForDirtyBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("mine"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	editor.InsertAtCursor("edited ")
+	if err := os.WriteFile(path, []byte("theirs!"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+
+	if _, err := editor.CheckDisk(); err != nil {
+		t.Fatalf("CheckDisk failed: %v", err)
+	}
+	if !editor.HasDiskConflict() {
+		t.Error("Expected a conflict for a dirty buffer")
+	}
+	if editor.GetText() != "edited mine" {
+		t.Errorf("Expected buffer to be kept, got %q", editor.GetText())
+	}
+
+	if err := editor.OverwriteSave(); err != nil {
+		t.Fatalf("OverwriteSave failed: %v", err)
+	}
+	if editor.HasDiskConflict() {
+		t.Error("Expected saving to resolve the conflict")
+	}
+}
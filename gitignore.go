@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore file.
+type ignoreRule struct {
+	base     string // directory holding the .gitignore, slash-separated
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path below base rather than the name
+}
+
+// ignoreList holds the .gitignore rules seen so far. Later rules override
+// earlier ones, so rules from deeper directories are loaded after those of
+// their parents.
+type ignoreList struct {
+	rules []ignoreRule
+}
+
+// load adds the rules of dir/.gitignore, if there is one.
+func (l *ignoreList) load(dir string) {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	base := filepath.ToSlash(dir)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(base, scanner.Text()); ok {
+			l.rules = append(l.rules, rule)
+		}
+	}
+}
+
+// parseIgnoreRule parses one .gitignore line. Blank lines and comments give
+// no rule.
+func parseIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash anywhere but the end ties the pattern to the .gitignore's
+	// directory.
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// ignored reports whether the file or directory at path is excluded.
+func (l *ignoreList) ignored(filePath string, isDir bool) bool {
+	slashPath := filepath.ToSlash(filePath)
+	ignored := false
+	for _, rule := range l.rules {
+		if rule.matches(slashPath, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(slashPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, ok := strings.CutPrefix(slashPath, r.base+"/")
+	if !ok {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	return matchGlobPath(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchGlobPath matches path segments against pattern segments, where "**"
+// stands for any number of segments.
+func matchGlobPath(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlobPath(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlobPath(pattern[1:], segments[1:])
+}
+
+// loadParentIgnores loads the .gitignore files between the top of the git
+// repository holding dir and dir itself, outermost first, so they apply to a
+// search started below the top.
+func (l *ignoreList) loadParentIgnores(dir string) {
+	var parents []string
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			// Not inside a repository, so no parent rules apply.
+			return
+		}
+		parents = append(parents, parent)
+		current = parent
+	}
+
+	for i := len(parents) - 1; i >= 0; i-- {
+		l.load(parents[i])
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreList_Ignored(t *testing.T) {
+	list := &ignoreList{}
+	for _, line := range []string{"# comment", "", "*.log", "!keep.log", "build/", "/top.txt", "docs/**/draft.md"} {
+		if rule, ok := parseIgnoreRule("/repo", line); ok {
+			list.rules = append(list.rules, rule)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"/repo/debug.log", false, true},
+		{"/repo/sub/debug.log", false, true},
+		{"/repo/keep.log", false, false},
+		{"/repo/build", true, true},
+		{"/repo/build", false, false},
+		{"/repo/sub/build", true, true},
+		{"/repo/top.txt", false, true},
+		{"/repo/sub/top.txt", false, false},
+		{"/repo/docs/draft.md", false, true},
+		{"/repo/docs/a/b/draft.md", false, true},
+		{"/repo/draft.md", false, false},
+		{"/other/debug.log", false, false},
+	}
+	for _, tt := range tests {
+		if got := list.ignored(filepath.FromSlash(tt.path), tt.isDir); got != tt.expected {
+			t.Errorf("%s: expected ignored %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestIgnoreList_LoadParentIgnores(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":  "ref: refs/heads/main\n",
+		".gitignore": "*.tmp\n",
+		"sub/a.txt":  "",
+	})
+
+	list := &ignoreList{}
+	list.loadParentIgnores(sub)
+	if !list.ignored(filepath.Join(sub, "x.tmp"), false) {
+		t.Errorf("Expected the repository's .gitignore to apply below its top")
+	}
+}
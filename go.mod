@@ -5,6 +5,7 @@ go 1.25.5
 require (
 	github.com/atotto/clipboard v0.1.4
 	github.com/nsf/termbox-go v1.1.1
+	github.com/rivo/uniseg v0.4.7
 )
 
 require github.com/mattn/go-runewidth v0.0.9 // indirect
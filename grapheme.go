@@ -0,0 +1,107 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// graphemeWindow is how many runes past the end of a range are read to
+// finish the cluster it ends in. Longer clusters are read again with a wider
+// window.
+const graphemeWindow = 32
+
+// maxGraphemeLookback bounds how far PrevGraphemeBoundary scans backwards for
+// a point to segment from. A cluster always starts after a line feed, so the
+// scan stops at the start of the line when that is nearer.
+const maxGraphemeLookback = 64
+
+// graphemeClusters splits runes into extended grapheme clusters, as defined
+// by UAX #29.
+func graphemeClusters(runes []rune) [][]rune {
+	var clusters [][]rune
+	text := string(runes)
+	state := -1
+	for start := 0; text != ""; {
+		var cluster string
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		end := start + utf8.RuneCountInString(cluster)
+		clusters = append(clusters, runes[start:end])
+		start = end
+	}
+	return clusters
+}
+
+// graphemeWidth returns the number of terminal columns a cluster occupies.
+// Clusters that would otherwise be invisible, such as tabs and stray
+// combining marks, take one column so the cursor can still sit on them.
+// Undecodable bytes and control characters take the width of their <0xNN>
+// escape.
+func graphemeWidth(cluster []rune) int {
+	if len(cluster) == 0 {
+		return 0
+	}
+	if escaped, ok := escapedCluster(cluster); ok {
+		return len(escaped)
+	}
+
+	return max(uniseg.StringWidth(string(cluster)), 1)
+}
+
+// NextGraphemeBoundary returns the offset where the cluster starting at offset
+// ends.
+func (pt *PieceTable) NextGraphemeBoundary(offset int) int {
+	offset = max(0, min(offset, pt.Length()))
+	boundary := offset
+	pt.forEachGrapheme(offset, offset+1, func(start int, cluster []rune) bool {
+		boundary = start + len(cluster)
+		return false
+	})
+	return boundary
+}
+
+// PrevGraphemeBoundary returns the start of the cluster that ends at offset.
+func (pt *PieceTable) PrevGraphemeBoundary(offset int) int {
+	offset = max(0, min(offset, pt.Length()))
+	if offset == 0 {
+		return 0
+	}
+
+	start := max(offset-maxGraphemeLookback, pt.lineStart(pt.lineBreaksBefore(offset-1)))
+	boundary := start
+	pt.forEachGrapheme(start, offset, func(clusterStart int, _ []rune) bool {
+		boundary = clusterStart
+		return true
+	})
+	return boundary
+}
+
+// forEachGrapheme calls fn with every cluster starting in [start, end), which
+// must begin on a cluster boundary. Walking stops early when fn returns false.
+func (pt *PieceTable) forEachGrapheme(start, end int, fn func(offset int, cluster []rune) bool) {
+	end = min(end, pt.Length())
+	window := graphemeWindow
+	for pos := start; pos < end; {
+		// Read past end so the last cluster is whole, unless it runs on to
+		// the end of what was read; then read again from its start.
+		readEnd := min(end+window, pt.Length())
+		text := pt.Substring(pos, readEnd)
+		state := -1
+		progressed := false
+		for text != "" && pos < end {
+			cluster, rest, _, next := uniseg.FirstGraphemeClusterInString(text, state)
+			if rest == "" && readEnd < pt.Length() {
+				break
+			}
+			runes := []rune(cluster)
+			if !fn(pos, runes) {
+				return
+			}
+			pos += len(runes)
+			text, state, progressed = rest, next, true
+		}
+		if !progressed {
+			window *= 2
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphemeClusters_SplitsClusters(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{"ascii", "abc", []string{"a", "b", "c"}},
+		{"combining accent", "e\u0301x", []string{"e\u0301", "x"}},
+		{"crlf", "a\r\nb", []string{"a", "\r\n", "b"}},
+		{"emoji zwj sequence", "👩‍💻!", []string{"👩‍💻", "!"}},
+		{"skin tone modifier", "👍🏽a", []string{"👍🏽", "a"}},
+		{"flag pairs", "🇬🇧🇫🇷🇩", []string{"🇬🇧", "🇫🇷", "🇩"}},
+		{"hangul jamo", "각가", []string{"각", "가"}},
+		{"variation selector", "❤️.", []string{"❤️", "."}},
+		{"indic prepend", "\u0D4E\u0D15a", []string{"\u0D4E\u0D15", "a"}},
+		{"newer emoji zwj sequence", "🧑‍🧑‍🧒x", []string{"🧑‍🧑‍🧒", "x"}},
+	}
+
+	for _, tt := range tests {
+		clusters := graphemeClusters([]rune(tt.text))
+		if len(clusters) != len(tt.expected) {
+			t.Errorf("%s: expected %d clusters, got %d", tt.name, len(tt.expected), len(clusters))
+			continue
+		}
+		for i, cluster := range clusters {
+			if string(cluster) != tt.expected[i] {
+				t.Errorf("%s: cluster %d expected %q, got %q", tt.name, i, tt.expected[i], string(cluster))
+			}
+		}
+	}
+}
+
+func TestGraphemeWidth_WideCharacters(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"a", 1},
+		{"日", 2},
+		{"e\u0301", 1},
+		{"🇬🇧", 2},
+		{"❤️", 2},
+		{"\t", 1},
+		{"🫠", 2},
+	}
+
+	for _, tt := range tests {
+		if width := graphemeWidth([]rune(tt.text)); width != tt.expected {
+			t.Errorf("%q: expected width %d, got %d", tt.text, tt.expected, width)
+		}
+	}
+}
+
+func TestPieceTable_NextGraphemeBoundary_SkipsCombiningMarks(t *testing.T) {
+	pt := NewPieceTable("ae\u0301\u0302b")
+
+	if next := pt.NextGraphemeBoundary(1); next != 4 {
+		t.Errorf("Expected boundary at 4, got %d", next)
+	}
+
+	if next := pt.NextGraphemeBoundary(5); next != 5 {
+		t.Errorf("Expected boundary at end to stay at 5, got %d", next)
+	}
+}
+
+func TestPieceTable_PrevGraphemeBoundary_SkipsClusters(t *testing.T) {
+	pt := NewPieceTable("x🇬🇧🇫🇷")
+	pt.Insert(5, "👩‍💻")
+
+	if prev := pt.PrevGraphemeBoundary(8); prev != 5 {
+		t.Errorf("Expected boundary at 5, got %d", prev)
+	}
+
+	if prev := pt.PrevGraphemeBoundary(5); prev != 3 {
+		t.Errorf("Expected boundary at 3, got %d", prev)
+	}
+
+	if prev := pt.PrevGraphemeBoundary(3); prev != 1 {
+		t.Errorf("Expected boundary at 1, got %d", prev)
+	}
+
+	if prev := pt.PrevGraphemeBoundary(0); prev != 0 {
+		t.Errorf("Expected boundary at 0, got %d", prev)
+	}
+}
+
+func TestPieceTable_GetLineColumn_CountsDisplayColumns(t *testing.T) {
+	pt := NewPieceTable("ab\n日本e\u0301x")
+
+	if _, col := pt.GetLineColumn(5); col != 4 {
+		t.Errorf("Expected column 4 after two wide characters, got %d", col)
+	}
+
+	if _, col := pt.GetLineColumn(7); col != 5 {
+		t.Errorf("Expected column 5 after combining sequence, got %d", col)
+	}
+}
+
+func TestPieceTable_GetOffsetFromLineColumn_SnapsToWideCharacter(t *testing.T) {
+	pt := NewPieceTable("日本語\nabc")
+
+	if offset := pt.GetOffsetFromLineColumn(0, 3); offset != 1 {
+		t.Errorf("Expected column inside wide character to resolve to 1, got %d", offset)
+	}
+
+	if offset := pt.GetOffsetFromLineColumn(0, 4); offset != 2 {
+		t.Errorf("Expected offset 2, got %d", offset)
+	}
+
+	if offset := pt.GetOffsetFromLineColumn(0, 10); offset != 3 {
+		t.Errorf("Expected offset clamped to line end 3, got %d", offset)
+	}
+}
+
+func TestPieceTable_GraphemeBoundaries_LongCluster(t *testing.T) {
+	// More combining marks than are read past a range at once.
+	cluster := "a" + strings.Repeat("\u0301", graphemeWindow*3)
+	pt := NewPieceTable("x" + cluster + "y")
+	end := 1 + len([]rune(cluster))
+
+	if got := pt.NextGraphemeBoundary(1); got != end {
+		t.Errorf("Expected the cluster to end at %d, got %d", end, got)
+	}
+	if got := pt.PrevGraphemeBoundary(end + 1); got != end {
+		t.Errorf("Expected y to start at %d, got %d", end, got)
+	}
+}
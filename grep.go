@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxGrepResults caps how many matches a project search collects.
+const maxGrepResults = 10000
+
+// grepSniffSize is how much of a file is checked for NUL bytes to skip
+// binary files. It is even, so BOM-less UTF-16 is not cut mid code unit.
+const grepSniffSize = 8000
+
+// GrepResult is one match found by a project search. Line and Col count from
+// 1, and Col counts runes, as in the references compilers and grep print.
+type GrepResult struct {
+	Path string
+	Line int
+	Col  int
+	Text string
+}
+
+// ProjectGrep searches every file under root, skipping .git, files ignored
+// by .gitignore and binary files. Files are searched concurrently. Results
+// are sorted by path and position; truncated is set when the search stopped
+// at maxGrepResults.
+func ProjectGrep(root string, search *Search) (results []GrepResult, truncated bool, err error) {
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, false, err
+	}
+
+	paths := make(chan string)
+	found := make(chan []GrepResult)
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+
+	var workers sync.WaitGroup
+	for range runtime.NumCPU() {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for path := range paths {
+				if matches := grepFile(path, search); len(matches) > 0 {
+					found <- matches
+				}
+			}
+		}()
+	}
+
+	walkErr := make(chan error, 1)
+	go func() {
+		walkErr <- walkProject(root, paths, done)
+		close(paths)
+		workers.Wait()
+		close(found)
+	}()
+
+	for matches := range found {
+		if truncated {
+			continue
+		}
+		if len(results)+len(matches) > maxGrepResults {
+			matches = matches[:maxGrepResults-len(results)]
+			truncated = true
+			stop()
+		}
+		results = append(results, matches...)
+	}
+	stop()
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return results, truncated, <-walkErr
+}
+
+// walkProject sends the files under root that .gitignore does not exclude to
+// paths, until the tree is walked or done is closed.
+func walkProject(root string, paths chan<- string, done <-chan struct{}) error {
+	ignores := &ignoreList{}
+	ignores.loadParentIgnores(root)
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Unreadable entries are skipped, as grep does.
+			return nil
+		}
+
+		if entry.IsDir() {
+			if path != root && (entry.Name() == ".git" || ignores.ignored(path, true)) {
+				return filepath.SkipDir
+			}
+			ignores.load(path)
+			return nil
+		}
+		if !entry.Type().IsRegular() || ignores.ignored(path, false) {
+			return nil
+		}
+
+		select {
+		case paths <- path:
+			return nil
+		case <-done:
+			return filepath.SkipAll
+		}
+	})
+}
+
+// grepFile returns the matches of search in one file. Binary and unreadable
+// files have none.
+func grepFile(path string, search *Search) []GrepResult {
+	if isBinaryFile(path) {
+		return nil
+	}
+	pt, err := NewFileManagerWithPath(path).ReadPieceTable()
+	if err != nil {
+		return nil
+	}
+	defer pt.Close()
+
+	var results []GrepResult
+	for offset := 0; len(results) < maxGrepResults; {
+		start, end, ok := search.Next(pt, offset)
+		if !ok {
+			break
+		}
+		line := pt.lineBreaksBefore(start)
+		results = append(results, GrepResult{
+			Path: path,
+			Line: line + 1,
+			Col:  start - pt.lineStart(line) + 1,
+			Text: pt.Lines(line, line+1)[0],
+		})
+		offset = end
+	}
+	return results
+}
+
+// isBinaryFile reports whether the start of a file holds a NUL byte, as grep
+// assumes of binary files. UTF-16 text is full of NULs, so files that look
+// like UTF-16 are searched.
+func isBinaryFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	sniff := make([]byte, grepSniffSize)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return true
+	}
+	switch detectEncoding(sniff[:n]) {
+	case UTF16LE, UTF16LEBOM, UTF16BE, UTF16BEBOM:
+		return false
+	}
+	return bytes.IndexByte(sniff[:n], 0) >= 0
+}
+
+// grepLineWidth is how much of a matching line the result list shows.
+const grepLineWidth = 200
+
+// GrepList is a read-only buffer listing the results of a project search,
+// one per line below a heading, in the path:line:col: text form of grep -n.
+type GrepList struct {
+	editor  *Editor
+	results []GrepResult
+}
+
+// NewGrepList lists results with paths relative to root, the cursor on the
+// first one.
+func NewGrepList(root string, search *Search, results []GrepResult, truncated bool) *GrepList {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d matches for %q in %s", len(results), search.Pattern(), root)
+	if truncated {
+		sb.WriteString(" (stopped early)")
+	}
+
+	for _, result := range results {
+		name, err := filepath.Rel(root, result.Path)
+		if err != nil {
+			name = result.Path
+		}
+		text := strings.TrimSpace(result.Text)
+		if runes := []rune(text); len(runes) > grepLineWidth {
+			text = string(runes[:grepLineWidth])
+		}
+		fmt.Fprintf(&sb, "\n%s:%d:%d: %s", name, result.Line, result.Col, text)
+	}
+
+	editor := NewEditor(sb.String())
+	editor.SetReadOnly(true)
+	if len(results) > 0 {
+		editor.GoToLineColumn(1, 0)
+	}
+	return &GrepList{editor: editor, results: results}
+}
+
+func (l *GrepList) Editor() *Editor {
+	return l.editor
+}
+
+// ResultAtCursor returns the result on the line the cursor is on.
+func (l *GrepList) ResultAtCursor() (GrepResult, bool) {
+	line, _ := l.editor.GetBuffer().GetLineColumn(l.editor.GetCursorPosition())
+	if line < 1 || line > len(l.results) {
+		return GrepResult{}, false
+	}
+	return l.results[line-1], true
+}
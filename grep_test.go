@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates files under dir, with their parent directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProjectGrep_SkipsIgnoredAndBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":     "*.log\nvendor/\n",
+		"b.txt":          "no match\nneedle here\n",
+		"a.txt":          "a needle\n\tand needle again\n",
+		"cjk.txt":        "日本 needle\n",
+		"sub/c.txt":      "needle",
+		"sub/.gitignore": "skip.txt\n",
+		"sub/skip.txt":   "needle",
+		"debug.log":      "needle",
+		"vendor/lib.txt": "needle",
+		"image.bin":      "needle\x00",
+		".git/needle":    "needle",
+		"utf16be.txt":    "\x00n\x00e\x00e\x00d\x00l\x00e",
+		"utf16le.txt":    "\xFF\xFEn\x00e\x00e\x00d\x00l\x00e\x00",
+	})
+
+	search, _ := NewSearch("needle", SearchOptions{})
+	results, truncated, err := ProjectGrep(dir, search)
+	if err != nil {
+		t.Fatalf("ProjectGrep failed: %v", err)
+	}
+	if truncated {
+		t.Errorf("Expected a complete search")
+	}
+
+	expected := []GrepResult{
+		{filepath.Join(dir, "a.txt"), 1, 3, "a needle"},
+		{filepath.Join(dir, "a.txt"), 2, 6, "\tand needle again"},
+		{filepath.Join(dir, "b.txt"), 2, 1, "needle here"},
+		{filepath.Join(dir, "cjk.txt"), 1, 4, "日本 needle"},
+		{filepath.Join(dir, "sub", "c.txt"), 1, 1, "needle"},
+		{filepath.Join(dir, "utf16be.txt"), 1, 1, "needle"},
+		{filepath.Join(dir, "utf16le.txt"), 1, 1, "needle"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func TestGrepList_ResultAtCursor(t *testing.T) {
+	results := []GrepResult{
+		{"/p/a.txt", 1, 3, "a needle"},
+		{"/p/sub/c.txt", 4, 1, "needle"},
+	}
+	search, _ := NewSearch("needle", SearchOptions{})
+	list := NewGrepList("/p", search, results, false)
+
+	lines := list.Editor().GetBuffer().Lines(1, 3)
+	if lines[1] != filepath.Join("sub", "c.txt")+":4:1: needle" {
+		t.Errorf("Expected a path:line:col line, got %q", lines[1])
+	}
+	if !list.Editor().IsReadOnly() {
+		t.Errorf("Expected the result list to be read-only")
+	}
+
+	if result, ok := list.ResultAtCursor(); !ok || result != results[0] {
+		t.Errorf("Expected the first result under the cursor, got %v", result)
+	}
+	list.Editor().GoToLineColumn(2, 5)
+	if result, ok := list.ResultAtCursor(); !ok || result != results[1] {
+		t.Errorf("Expected the second result, got %v", result)
+	}
+	list.Editor().GoToLineColumn(0, 0)
+	if _, ok := list.ResultAtCursor(); ok {
+		t.Errorf("Expected no result on the heading")
+	}
+}
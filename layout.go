@@ -0,0 +1,210 @@
+package main
+
+import "unicode/utf8"
+
+// SplitDirection is how a split divides its area between its two halves.
+type SplitDirection int
+
+const (
+	// SplitHorizontal stacks the halves one above the other.
+	SplitHorizontal SplitDirection = iota
+	// SplitVertical puts the halves side by side, with a divider between.
+	SplitVertical
+)
+
+// Window is a pane showing an editor through its own viewport. Several
+// windows can show the same editor; the focused one uses the editor's cursor,
+// while the others keep their own cursor and first visible line as offsets
+// that follow edits to the buffer, so they stay on the same text.
+type Window struct {
+	editor  *Editor
+	scrollX int
+	scrollY int
+	top     int // offset of the first visible line
+	cursor  int // cursor offset while the window is not focused
+
+	stopListening func()
+}
+
+func NewWindow(editor *Editor) *Window {
+	w := &Window{}
+	w.SetEditor(editor)
+	return w
+}
+
+func (w *Window) Editor() *Editor {
+	return w.editor
+}
+
+// SetEditor shows another editor in the window, from the top of its buffer.
+func (w *Window) SetEditor(editor *Editor) {
+	w.Close()
+	w.editor = editor
+	w.scrollX, w.scrollY, w.top = 0, 0, 0
+	w.cursor = editor.GetCursorPosition()
+	w.stopListening = editor.GetBuffer().AddChangeListener(w.bufferChanged)
+}
+
+// Close stops the window following its buffer.
+func (w *Window) Close() {
+	if w.stopListening != nil {
+		w.stopListening()
+		w.stopListening = nil
+	}
+}
+
+func (w *Window) bufferChanged(offset int, inserted string, deleted int) {
+	runes := utf8.RuneCountInString(inserted)
+	w.top = shiftOffset(w.top, offset, runes, deleted)
+	w.cursor = shiftOffset(w.cursor, offset, runes, deleted)
+}
+
+// shiftOffset moves pos past an edit at offset that deleted some runes and
+// inserted others. Positions inside deleted text move to where it was.
+func shiftOffset(pos, offset, inserted, deleted int) int {
+	if pos < offset {
+		return pos
+	}
+	if pos < offset+deleted {
+		return offset + inserted
+	}
+	return pos - deleted + inserted
+}
+
+// Pane is where a window is drawn, including its status line.
+type Pane struct {
+	Window *Window
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// Layout is a tree of splits with a window at each leaf.
+type Layout struct {
+	root *layoutNode
+}
+
+type layoutNode struct {
+	window    *Window // set on leaves only
+	direction SplitDirection
+	first     *layoutNode
+	second    *layoutNode
+	parent    *layoutNode
+}
+
+func NewLayout(window *Window) *Layout {
+	return &Layout{root: &layoutNode{window: window}}
+}
+
+// Split divides the area of window in two, putting a new window on the same
+// editor and at the same position after it, and returns the new window.
+func (l *Layout) Split(window *Window, direction SplitDirection) *Window {
+	leaf := l.find(l.root, window)
+	if leaf == nil {
+		return nil
+	}
+
+	split := NewWindow(window.editor)
+	split.scrollX, split.scrollY, split.top = window.scrollX, window.scrollY, window.top
+	split.cursor = window.editor.GetCursorPosition()
+
+	// The leaf becomes the split, with the old window as its first half.
+	leaf.first = &layoutNode{window: window, parent: leaf}
+	leaf.second = &layoutNode{window: split, parent: leaf}
+	leaf.window = nil
+	leaf.direction = direction
+	return split
+}
+
+// Close removes window, giving its area to the other half of its split. The
+// last window can not be closed.
+func (l *Layout) Close(window *Window) bool {
+	leaf := l.find(l.root, window)
+	if leaf == nil || leaf.parent == nil {
+		return false
+	}
+
+	parent := leaf.parent
+	sibling := parent.first
+	if sibling == leaf {
+		sibling = parent.second
+	}
+	*parent = layoutNode{
+		window:    sibling.window,
+		direction: sibling.direction,
+		first:     sibling.first,
+		second:    sibling.second,
+		parent:    parent.parent,
+	}
+	for _, child := range []*layoutNode{parent.first, parent.second} {
+		if child != nil {
+			child.parent = parent
+		}
+	}
+	window.Close()
+	return true
+}
+
+// Only closes every window but window.
+func (l *Layout) Only(window *Window) {
+	for _, other := range l.Windows() {
+		if other != window {
+			other.Close()
+		}
+	}
+	l.root = &layoutNode{window: window}
+}
+
+// Windows returns the windows from top left to bottom right.
+func (l *Layout) Windows() []*Window {
+	var windows []*Window
+	var walk func(n *layoutNode)
+	walk = func(n *layoutNode) {
+		if n.window != nil {
+			windows = append(windows, n.window)
+			return
+		}
+		walk(n.first)
+		walk(n.second)
+	}
+	walk(l.root)
+	return windows
+}
+
+// Arrange divides the area at x, y into the panes of the windows. Side by
+// side panes are separated by a one column divider, left of the second pane.
+func (l *Layout) Arrange(x, y, width, height int) []Pane {
+	var panes []Pane
+	var arrange func(n *layoutNode, x, y, width, height int)
+	arrange = func(n *layoutNode, x, y, width, height int) {
+		if n.window != nil {
+			panes = append(panes, Pane{Window: n.window, X: x, Y: y, Width: width, Height: height})
+			return
+		}
+		if n.direction == SplitHorizontal {
+			top := height / 2
+			arrange(n.first, x, y, width, top)
+			arrange(n.second, x, y+top, width, height-top)
+			return
+		}
+		left := (width - 1) / 2
+		arrange(n.first, x, y, left, height)
+		arrange(n.second, x+left+1, y, width-left-1, height)
+	}
+	arrange(l.root, x, y, width, height)
+	return panes
+}
+
+func (l *Layout) find(n *layoutNode, window *Window) *layoutNode {
+	if n.window != nil {
+		if n.window == window {
+			return n
+		}
+		return nil
+	}
+	if found := l.find(n.first, window); found != nil {
+		return found
+	}
+	return l.find(n.second, window)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayout_SplitAndArrange(t *testing.T) {
+	editor := NewEditor("text")
+	first := NewWindow(editor)
+	layout := NewLayout(first)
+
+	right := layout.Split(first, SplitVertical)
+	below := layout.Split(right, SplitHorizontal)
+
+	if windows := layout.Windows(); !reflect.DeepEqual(windows, []*Window{first, right, below}) {
+		t.Errorf("Expected windows in order, got %v", windows)
+	}
+	if right.Editor() != editor || below.Editor() != editor {
+		t.Errorf("Expected split windows to show the same editor")
+	}
+
+	expected := []Pane{
+		{Window: first, X: 0, Y: 0, Width: 40, Height: 24},
+		{Window: right, X: 41, Y: 0, Width: 40, Height: 12},
+		{Window: below, X: 41, Y: 12, Width: 40, Height: 12},
+	}
+	if panes := layout.Arrange(0, 0, 81, 24); !reflect.DeepEqual(panes, expected) {
+		t.Errorf("Expected panes %+v, got %+v", expected, panes)
+	}
+}
+
+func TestLayout_CloseGivesAreaToSibling(t *testing.T) {
+	first := NewWindow(NewEditor("text"))
+	layout := NewLayout(first)
+	right := layout.Split(first, SplitVertical)
+	below := layout.Split(right, SplitHorizontal)
+
+	if !layout.Close(right) {
+		t.Fatalf("Expected the window to close")
+	}
+	expected := []Pane{
+		{Window: first, X: 0, Y: 0, Width: 40, Height: 24},
+		{Window: below, X: 41, Y: 0, Width: 40, Height: 24},
+	}
+	if panes := layout.Arrange(0, 0, 81, 24); !reflect.DeepEqual(panes, expected) {
+		t.Errorf("Expected panes %+v, got %+v", expected, panes)
+	}
+
+	layout.Close(first)
+	if layout.Close(below) {
+		t.Errorf("Expected the last window to stay open")
+	}
+	if windows := layout.Windows(); len(windows) != 1 || windows[0] != below {
+		t.Errorf("Expected only the remaining window, got %v", windows)
+	}
+}
+
+func TestWindow_FollowsEditsFromAnotherWindow(t *testing.T) {
+	editor := NewEditor("one\ntwo\nthree\nfour")
+	window := NewWindow(editor)
+	window.top = 8     // "three"
+	window.cursor = 10 // "three" at "r"
+
+	editor.SetCursorPosition(0)
+	editor.TypeAtCursor("zero\n")
+	if window.top != 13 || window.cursor != 15 {
+		t.Errorf("Expected offsets moved past the insert, got top %d, cursor %d", window.top, window.cursor)
+	}
+	if line, _ := editor.GetBuffer().GetLineColumn(window.top); line != 3 {
+		t.Errorf("Expected the window to stay on \"three\" at line 3, got %d", line)
+	}
+
+	editor.GetBuffer().Delete(12, 4) // "\nthr"
+	if window.top != 12 || window.cursor != 12 {
+		t.Errorf("Expected offsets in deleted text moved to the deletion, got top %d, cursor %d", window.top, window.cursor)
+	}
+
+	window.Close()
+	editor.TypeAtCursor("more")
+	if window.top != 12 {
+		t.Errorf("Expected a closed window to stop following edits, got top %d", window.top)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LineEnding is the line break style of a file. Buffers always hold '\n'
+// internally; the file's style is applied again when it is written.
+type LineEnding int
+
+const (
+	LF LineEnding = iota
+	CRLF
+	CR
+)
+
+func (le LineEnding) String() string {
+	switch le {
+	case CRLF:
+		return "CRLF"
+	case CR:
+		return "CR"
+	default:
+		return "LF"
+	}
+}
+
+func (le LineEnding) sequence() string {
+	switch le {
+	case CRLF:
+		return "\r\n"
+	case CR:
+		return "\r"
+	default:
+		return "\n"
+	}
+}
+
+func ParseLineEnding(name string) (LineEnding, error) {
+	switch strings.ToLower(name) {
+	case "lf", "unix":
+		return LF, nil
+	case "crlf", "dos":
+		return CRLF, nil
+	case "cr", "mac":
+		return CR, nil
+	default:
+		return LF, fmt.Errorf("unknown line ending %q", name)
+	}
+}
+
+// detectLineEnding returns the most common line break style in text, or LF
+// when it has no line breaks.
+func detectLineEnding(text string) LineEnding {
+	var lf, crlf, cr int
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		}
+	}
+
+	switch {
+	case crlf > lf && crlf >= cr:
+		return CRLF
+	case cr > lf && cr > crlf:
+		return CR
+	default:
+		return LF
+	}
+}
+
+// splitLineEnding detects the line break style of file text in enc and
+// returns the text normalized to '\n'. Breaks in another style are kept
+// verbatim, so the stray breaks of a file mixing styles survive a save byte
+// for byte without the rest of the file losing its normalization. A stray CR
+// stays a '\r'; a stray LF, which '\n' can't stand for, is kept as the raw
+// bytes enc writes for it.
+func splitLineEnding(text string, enc Encoding) (string, LineEnding) {
+	le := detectLineEnding(text)
+	if !strings.Contains(text, "\r") {
+		return text, le
+	}
+
+	var strayLF string
+	if le != LF {
+		lf, _ := appendEncoded(nil, "\n", enc)
+		for _, b := range lf {
+			strayLF += string(rawByteRune(b))
+		}
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\r' && i+1 < len(text) && text[i+1] == '\n':
+			i++
+			switch le {
+			case CRLF:
+				sb.WriteByte('\n')
+			case CR:
+				sb.WriteString("\n" + strayLF)
+			default:
+				sb.WriteString("\r\n")
+			}
+		case c == '\r' && le == CR, c == '\n' && le == LF:
+			sb.WriteByte('\n')
+		case c == '\n':
+			sb.WriteString(strayLF)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), le
+}
+
+// normalizeLineEndings turns every CRLF and lone CR into '\n'.
+func normalizeLineEndings(text string) string {
+	if !strings.Contains(text, "\r") {
+		return text
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+func applyLineEnding(text string, le LineEnding) string {
+	if le == LF {
+		return text
+	}
+	return strings.ReplaceAll(text, "\n", le.sequence())
+}
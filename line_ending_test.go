@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectLineEnding(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected LineEnding
+	}{
+		{"", LF},
+		{"no breaks", LF},
+		{"a\nb\n", LF},
+		{"a\r\nb\r\n", CRLF},
+		{"a\rb\r", CR},
+		{"a\r\nb\r\nc\n", CRLF},
+		{"a\nb\nc\r\n", LF},
+	}
+
+	for _, tt := range tests {
+		if got := detectLineEnding(tt.text); got != tt.expected {
+			t.Errorf("detectLineEnding(%q) = %v, want %v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	got := normalizeLineEndings("a\r\nb\rc\nd")
+	if got != "a\nb\nc\nd" {
+		t.Errorf("Expected all breaks as \\n, got %q", got)
+	}
+}
+
+func TestApplyLineEnding_RoundTrip(t *testing.T) {
+	for _, le := range []LineEnding{LF, CRLF, CR} {
+		original := applyLineEnding("one\ntwo\n", le)
+		if detectLineEnding(original) != le {
+			t.Errorf("Expected %v to be detected from %q", le, original)
+		}
+		if normalizeLineEndings(original) != "one\ntwo\n" {
+			t.Errorf("Expected %q to normalize back, got %q", original, normalizeLineEndings(original))
+		}
+	}
+}
+
+func TestSplitLineEnding_KeepsStrayBreaksVerbatim(t *testing.T) {
+	text, le := splitLineEnding("a\r\nb\r\n", UTF8)
+	if text != "a\nb\n" || le != CRLF {
+		t.Errorf("Expected CRLF text to normalize, got %q, %v", text, le)
+	}
+
+	text, le = splitLineEnding("a\r\nb\nc\r", UTF8)
+	if text != "a\r\nb\nc\r" || le != LF {
+		t.Errorf("Expected text without a majority style to be kept as is, got %q, %v", text, le)
+	}
+
+	text, le = splitLineEnding("a\r\nb\r\nc\nd\r\ne\r", UTF8)
+	strayLF := string(rawByteRune('\n'))
+	if text != "a\nb\nc"+strayLF+"d\ne\r" || le != CRLF {
+		t.Errorf("Expected only the stray breaks to be kept, got %q, %v", text, le)
+	}
+}
+
+func TestSplitLineEnding_MixedStylesRoundTrip(t *testing.T) {
+	texts := []string{
+		"a\r\nb\r\nc\nd\r\n",
+		"a\nb\nc\r\nd\n",
+		"a\rb\rc\r\nd\ne\r",
+		"\n\r\n\r\n\r\r\n",
+	}
+	for _, enc := range []Encoding{UTF8, UTF16LE, UTF16BEBOM, Windows1252} {
+		for _, original := range texts {
+			data, _ := encodeText(original, enc)
+			decoded, _ := decodeText(data, enc)
+			text, le := splitLineEnding(decoded, enc)
+
+			var out bytes.Buffer
+			encoder := newTextEncoder(&out, enc, le)
+			encoder.Write([]byte(text))
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("%v: encode failed: %v", enc, err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("%v %q: round trip gave % x, want % x", enc, original, out.Bytes(), data)
+			}
+		}
+	}
+}
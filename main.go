@@ -1,26 +1,54 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/nsf/termbox-go"
 )
 
 func main() {
-	var editor *Editor
-	var err error
+	opts, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	if opts.Help {
+		return
+	}
+	if opts.Version {
+		fmt.Println("texteditor", version)
+		return
+	}
+	if err := opts.loadConfig(); err != nil {
+		log.Fatalf("Failed to read config: %v", err)
+	}
 
-	if len(os.Args) > 1 {
-		filePath := os.Args[1]
-		editor, err = NewEditorFromFile(filePath)
-		if err != nil {
-			log.Fatalf("Failed to open file %s: %v", filePath, err)
+	editors, stdinEditor, err := opts.openEditors()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Standard input is read now, so keys come from the terminal. When
+	// standard output is not a terminal either, the edited text is written to
+	// it on exit, so the editor can sit in a pipeline.
+	toStdout := false
+	if stdinEditor != nil {
+		if err := reopenTerminal(); err != nil {
+			log.Fatalf("Failed to open terminal: %v", err)
 		}
-	} else {
-		editor = NewEditor("Hello World!\nThis is a simple text editor.\nTry editing this text!")
+		toStdout = !isTerminal(os.Stdout)
 	}
 
+	buffers := NewBufferManager(editors)
+	editor := buffers.Current().Editor
 	display := NewDisplay(editor)
 
 	err = display.Init()
@@ -29,19 +57,295 @@ func main() {
 	}
 	defer display.Close()
 
+	go func() {
+		for range time.Tick(swapInterval) {
+			termbox.Interrupt()
+		}
+	}()
+
+	editor.WatchFile(termbox.Interrupt)
+
+	recovery := editor.PendingSwapRecovery()
 	inputMode := false
 	inputPrompt := ""
 	inputBuffer := ""
+	var inputSubmit func(string)
 	confirmQuit := false
+	confirmOverwrite := false
+	findMode := false
+	findInput := ""
+	findOptions := SearchOptions{}
+	findOrigin := 0
+	findNote := ""
+	replaceAfterFind := false
+	var replacer *Replacer
+
+	// updateFind searches again as the find prompt changes, starting from
+	// where the cursor was when the prompt opened.
+	updateFind := func() {
+		findNote = ""
+		editor.SetCursorPosition(findOrigin)
+		if findInput == "" {
+			editor.SetSearch(nil)
+			return
+		}
+		search, err := NewSearch(findInput, findOptions)
+		if err != nil {
+			editor.SetSearch(nil)
+			findNote = "invalid pattern"
+			return
+		}
+		editor.SetSearch(search)
+		if found, _ := editor.FindFrom(findOrigin); !found {
+			findNote = "no matches"
+		}
+	}
+
+	render := func() {
+		switch {
+		case recovery != nil:
+			display.RenderWithPrompt(recovery.Prompt(), "")
+		case replacer != nil:
+			display.RenderWithPrompt("Replace this match? (y)es, (n)o, (a)ll, (q)uit: ", "")
+		default:
+			display.Render()
+		}
+	}
+
+	// startReplace asks for the replacement for the current search and then
+	// steps through its matches.
+	startReplace := func() {
+		inputMode = true
+		inputPrompt = "Replace with: "
+		inputBuffer = ""
+		inputSubmit = func(text string) {
+			if editor.IsReadOnly() {
+				display.SetMessage(ErrReadOnly.Error())
+				return
+			}
+			replacer = editor.NewReplacer(editor.GetSearch(), text)
+			if _, _, ok := replacer.Match(); !ok {
+				replacer = nil
+				display.SetMessage("No matches")
+			}
+		}
+		display.RenderWithPrompt(inputPrompt, inputBuffer)
+	}
+
+	// keepView remembers where the current buffer is scrolled to, before
+	// switching away from it.
+	keepView := func() {
+		buffer := buffers.Current()
+		buffer.ScrollX, buffer.ScrollY = display.Scroll()
+	}
+
+	// show displays the current buffer as it was when last shown.
+	show := func() {
+		buffer := buffers.Current()
+		editor = buffer.Editor
+		display.SetEditor(editor)
+		display.SetScroll(buffer.ScrollX, buffer.ScrollY)
+		editor.WatchFile(termbox.Interrupt)
+		recovery = editor.PendingSwapRecovery()
+	}
+
+	// announce names the current buffer on the status bar.
+	announce := func() {
+		display.SetMessage(fmt.Sprintf("Buffer %d of %d: %s", buffers.Index()+1, buffers.Len(), buffers.Current().Name()))
+	}
+
+	// switchBuffer moves to another buffer.
+	switchBuffer := func(move func() *Buffer) {
+		keepView()
+		move()
+		show()
+		announce()
+	}
+
+	// open adds an editor after the current buffer and shows it.
+	open := func(opened *Editor) {
+		switchBuffer(func() *Buffer { return buffers.Open(opened) })
+	}
 
-	display.Render()
+	// next closes the current buffer and moves on to the next one, or back to
+	// the one before if it was the last, reporting whether any are left.
+	// Standard input stays open until its text is written out.
+	next := func() bool {
+		closed := editor
+		if editor != stdinEditor {
+			editor.Close()
+		}
+		if !buffers.Remove() {
+			return false
+		}
+
+		show()
+		display.ReplaceEditor(closed, editor)
+		announce()
+		render()
+		return true
+	}
+
+	// openPath shows the file at path, switching to its buffer if it is
+	// already open, and reports whether it could.
+	openPath := func(path string) bool {
+		if i := buffers.FindFile(path); i >= 0 {
+			switchBuffer(func() *Buffer { return buffers.SwitchTo(i) })
+			return true
+		}
+		opened, err := opts.openFile(path)
+		if err != nil {
+			display.SetMessage(err.Error())
+			return false
+		}
+		open(opened)
+		return true
+	}
+
+	// focusChanged makes the buffer of the newly focused window current.
+	focusChanged := func() {
+		editor = display.Editor()
+		if i := buffers.IndexOf(editor); i >= 0 {
+			buffers.SwitchTo(i)
+		}
+		recovery = editor.PendingSwapRecovery()
+	}
+
+	// windowCommand is set after Ctrl+X, while waiting for the key naming
+	// what to do with the windows.
+	windowCommand := false
+
+	// bufferList, while set, is shown in place of the current buffer to pick
+	// another one from.
+	var bufferList *Editor
+
+	var grepList *GrepList
+
+	// openResult shows the file of a project search result at the match,
+	// switching to it if it is already open.
+	openResult := func(result GrepResult) {
+		if openPath(result.Path) {
+			editor.GoToLineRune(result.Line-1, result.Col-1)
+		}
+	}
+
+	// startGrep asks for a pattern and lists its matches in the files under
+	// the current file's directory, using the find options.
+	startGrep := func() {
+		root := "."
+		if editor.GetFileManager().HasFile() {
+			root = filepath.Dir(editor.GetFileManager().GetFilePath())
+		}
+
+		inputMode = true
+		inputPrompt = "Grep: "
+		inputBuffer = ""
+		inputSubmit = func(pattern string) {
+			if pattern == "" {
+				return
+			}
+			search, err := NewSearch(pattern, findOptions)
+			if err != nil {
+				display.SetMessage(err.Error())
+				return
+			}
+			display.RenderWithPrompt("Searching...", "")
+			results, truncated, err := ProjectGrep(root, search)
+			if err != nil {
+				display.SetMessage(err.Error())
+				return
+			}
+			if abs, err := filepath.Abs(root); err == nil {
+				root = abs
+			}
+
+			// A new search replaces the previous result list, if it is
+			// still open.
+			previous := -1
+			var old *Editor
+			if grepList != nil {
+				old = grepList.Editor()
+				previous = buffers.IndexOf(old)
+			}
+			if previous >= 0 {
+				old.Close()
+			}
+			grepList = NewGrepList(root, search, results, truncated)
+			grepList.Editor().SetSearch(search)
+			if previous >= 0 {
+				keepView()
+				buffers.Replace(previous, grepList.Editor())
+				display.ReplaceEditor(old, grepList.Editor())
+				buffers.SwitchTo(previous)
+				show()
+			} else {
+				open(grepList.Editor())
+			}
+		}
+		display.RenderWithPrompt(inputPrompt, inputBuffer)
+	}
+
+	render()
 
 	for {
 		ev := termbox.PollEvent()
 
+		if ev.Type == termbox.EventInterrupt {
+			for _, buffer := range buffers.Buffers() {
+				if err := buffer.Editor.SyncSwap(); err != nil {
+					display.SetMessage("Swap file: " + err.Error())
+				}
+			}
+			// Leave open prompts alone; the next interrupt checks again.
+			if recovery != nil || inputMode || findMode || replacer != nil || confirmQuit || confirmOverwrite || bufferList != nil || windowCommand {
+				continue
+			}
+			message, err := editor.CheckDisk()
+			if err != nil {
+				message = err.Error()
+			}
+			if message != "" {
+				display.SetMessage(message)
+				display.Render()
+			}
+			continue
+		}
+
 		if ev.Type == termbox.EventKey {
+			display.SetMessage("")
+
+			if recovery != nil {
+				switch ev.Ch {
+				case 'r', 'R':
+					if recovery.Err != nil {
+						continue
+					}
+					if err := editor.RecoverSwap(); err != nil {
+						display.SetMessage(err.Error())
+					}
+				case 'd', 'D':
+					display.RenderWithPrompt(editor.SwapDiff()+". "+recovery.Prompt(), "")
+					continue
+				case 'x', 'X':
+					if err := editor.DiscardSwap(); err != nil {
+						display.SetMessage(err.Error())
+					}
+				case 'q', 'Q':
+					return
+				default:
+					continue
+				}
+				recovery = nil
+				display.Render()
+				continue
+			}
+
 			if confirmQuit {
 				if ev.Ch == 'y' || ev.Ch == 'Y' {
+					confirmQuit = false
+					if next() {
+						continue
+					}
 					break
 				} else if ev.Ch == 'n' || ev.Ch == 'N' || ev.Key == termbox.KeyEsc {
 					confirmQuit = false
@@ -50,21 +354,110 @@ func main() {
 				continue
 			}
 
+			if confirmOverwrite {
+				var err error
+				switch ev.Ch {
+				case 'o', 'O':
+					err = editor.OverwriteSave()
+					display.SetMessage(saveWarning(editor))
+				case 'r', 'R':
+					err = editor.ReloadFromDisk()
+				case 'c', 'C':
+				default:
+					if ev.Key != termbox.KeyEsc {
+						continue
+					}
+				}
+				if err != nil {
+					display.SetMessage(err.Error())
+				}
+				confirmOverwrite = false
+				display.Render()
+				continue
+			}
+
+			if replacer != nil {
+				switch {
+				case ev.Ch == 'y' || ev.Ch == 'Y':
+					replacer.Replace()
+				case ev.Ch == 'n' || ev.Ch == 'N':
+					replacer.Skip()
+				case ev.Ch == 'a' || ev.Ch == 'A':
+					replacer.ReplaceAll()
+				case ev.Ch == 'q' || ev.Ch == 'Q' || ev.Key == termbox.KeyEsc:
+				default:
+					continue
+				}
+				if _, _, ok := replacer.Match(); !ok || ev.Ch == 'q' || ev.Ch == 'Q' || ev.Key == termbox.KeyEsc {
+					display.SetMessage(fmt.Sprintf("Replaced %d occurrences", replacer.Count()))
+					replacer = nil
+				}
+				render()
+				continue
+			}
+
+			if windowCommand {
+				windowCommand = false
+				switch ev.Ch {
+				case '2':
+					display.Split(SplitHorizontal)
+				case '3':
+					display.Split(SplitVertical)
+				case 'o', 'O':
+					display.FocusNext()
+					focusChanged()
+				case '0':
+					if display.CloseWindow() {
+						focusChanged()
+					} else {
+						display.SetMessage("Can't close the only window")
+					}
+				case '1':
+					display.OnlyWindow()
+				}
+				render()
+				continue
+			}
+
+			if bufferList != nil {
+				switch ev.Key {
+				case termbox.KeyArrowUp:
+					bufferList.MoveCursorUp()
+				case termbox.KeyArrowDown:
+					bufferList.MoveCursorDown()
+				case termbox.KeyEnter, termbox.KeyEsc, termbox.KeyCtrlB:
+					line, _ := bufferList.GetBuffer().GetLineColumn(bufferList.GetCursorPosition())
+					bufferList.Close()
+					bufferList = nil
+					if ev.Key == termbox.KeyEnter {
+						buffers.SwitchTo(line)
+					}
+					show()
+					render()
+					continue
+				}
+				display.Render()
+				continue
+			}
+
 			if inputMode {
 				if ev.Key == termbox.KeyEsc {
 					inputMode = false
 					inputBuffer = ""
 					display.Render()
 				} else if ev.Key == termbox.KeyEnter {
-					if inputBuffer != "" {
-						err := editor.SaveAs(inputBuffer)
-						if err != nil {
-							// TODO: Handle save errors.
-						}
-					}
+					// The submitted prompt may open another one, so clear
+					// this one first.
+					submit, input := inputSubmit, inputBuffer
 					inputMode = false
 					inputBuffer = ""
-					display.Render()
+					submit(input)
+					if !inputMode {
+						render()
+					}
+				} else if ev.Key == termbox.KeySpace {
+					inputBuffer += " "
+					display.RenderWithPrompt(inputPrompt, inputBuffer)
 				} else if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
 					if len(inputBuffer) > 0 {
 						runes := []rune(inputBuffer)
@@ -78,19 +471,176 @@ func main() {
 				continue
 			}
 
+			if findMode {
+				switch ev.Key {
+				case termbox.KeyEsc:
+					editor.SetSearch(nil)
+					editor.SetCursorPosition(findOrigin)
+					findMode = false
+					replaceAfterFind = false
+				case termbox.KeyEnter:
+					findMode = false
+					if replaceAfterFind && editor.GetSearch() != nil {
+						replaceAfterFind = false
+						startReplace()
+						continue
+					}
+					replaceAfterFind = false
+				case termbox.KeyBackspace, termbox.KeyBackspace2:
+					if runes := []rune(findInput); len(runes) > 0 {
+						findInput = string(runes[:len(runes)-1])
+						updateFind()
+					}
+				case termbox.KeyCtrlT:
+					findOptions.IgnoreCase = !findOptions.IgnoreCase
+					updateFind()
+				case termbox.KeyCtrlW:
+					findOptions.WholeWord = !findOptions.WholeWord
+					updateFind()
+				case termbox.KeyCtrlR:
+					findOptions.Regexp = !findOptions.Regexp
+					updateFind()
+				case termbox.KeyArrowDown, termbox.KeyCtrlN, termbox.KeyArrowUp, termbox.KeyCtrlP:
+					if ev.Key == termbox.KeyArrowDown || ev.Key == termbox.KeyCtrlN {
+						editor.FindNext()
+					} else {
+						editor.FindPrev()
+					}
+					findOrigin = editor.GetCursorPosition()
+				case termbox.KeySpace:
+					findInput += " "
+					updateFind()
+				default:
+					if ev.Ch != 0 {
+						findInput += string(ev.Ch)
+						updateFind()
+					}
+				}
+
+				if findMode {
+					display.RenderWithPrompt(findPrompt(findOptions, findNote), findInput)
+				} else {
+					display.Render()
+				}
+				continue
+			}
+
+			// Ctrl+R replaces the current search, or asks for one first.
+			if ev.Key == termbox.KeyCtrlR && editor.GetSearch() != nil {
+				startReplace()
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlF || ev.Key == termbox.KeyCtrlR {
+				replaceAfterFind = ev.Key == termbox.KeyCtrlR
+				findMode = true
+				findInput = ""
+				findNote = ""
+				findOrigin = editor.GetCursorPosition()
+				editor.SetSearch(nil)
+				display.RenderWithPrompt(findPrompt(findOptions, findNote), findInput)
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlN || ev.Key == termbox.KeyCtrlP {
+				var found, wrapped bool
+				if ev.Key == termbox.KeyCtrlN {
+					found, wrapped = editor.FindNext()
+				} else {
+					found, wrapped = editor.FindPrev()
+				}
+				if editor.GetSearch() == nil {
+					display.SetMessage("No search, press Ctrl+F")
+				} else if !found {
+					display.SetMessage("No matches")
+				} else if wrapped {
+					display.SetMessage("Search wrapped")
+				}
+			}
+
+			if ev.Key == termbox.KeyEsc {
+				editor.SetSearch(nil)
+			}
+
+			if ev.Key == termbox.KeyCtrlO {
+				inputMode = true
+				inputPrompt = "Open: "
+				inputBuffer = ""
+				inputSubmit = func(path string) {
+					if path != "" {
+						openPath(path)
+					}
+				}
+				display.RenderWithPrompt(inputPrompt, inputBuffer)
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlT || ev.Key == termbox.KeyCtrlU {
+				if ev.Key == termbox.KeyCtrlT {
+					switchBuffer(buffers.Next)
+				} else {
+					switchBuffer(buffers.Prev)
+				}
+				render()
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlX {
+				windowCommand = true
+				display.SetMessage("Window: 2 split below, 3 split right, o other, 0 close, 1 only")
+				display.Render()
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlB {
+				keepView()
+				bufferList = NewEditor(buffers.List())
+				bufferList.SetReadOnly(true)
+				bufferList.GoToLineColumn(buffers.Index(), 0)
+				display.SetEditor(bufferList)
+				display.SetMessage("Up/Down: Choose | Enter: Switch | Esc: Cancel")
+				display.Render()
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlG {
+				startGrep()
+				continue
+			}
+
+			if ev.Key == termbox.KeyEnter && grepList != nil && editor == grepList.Editor() {
+				if result, ok := grepList.ResultAtCursor(); ok {
+					openResult(result)
+				}
+				render()
+				continue
+			}
+
 			if ev.Key == termbox.KeyCtrlQ {
-				if editor.GetFileManager().IsDirty() {
+				// Quitting hands the buffer on to standard output, which is
+				// as good as saving it.
+				if editor.GetFileManager().IsDirty() && !(toStdout && editor == stdinEditor) {
 					confirmQuit = true
 					display.RenderWithPrompt("Unsaved changes! Are you sure you want to quit? (y/n): ", "")
 					continue
 				}
+				if next() {
+					continue
+				}
 				break
 			}
 
 			if ev.Key == termbox.KeyCtrlS {
 				err := editor.Save()
+				if errors.Is(err, ErrChangedOnDisk) {
+					confirmOverwrite = true
+					display.RenderWithPrompt("File changed on disk! (o)verwrite, (r)eload, (c)ancel: ", "")
+					continue
+				}
 				if err != nil {
-					// TODO: Handle save errors.
+					display.SetMessage(err.Error())
+				} else {
+					display.SetMessage(saveWarning(editor))
 				}
 			}
 
@@ -98,6 +648,31 @@ func main() {
 				inputMode = true
 				inputPrompt = "Save as: "
 				inputBuffer = ""
+				inputSubmit = func(path string) {
+					if path == "" {
+						return
+					}
+					if err := editor.SaveAs(path); err != nil {
+						display.SetMessage(err.Error())
+					} else {
+						display.SetMessage(saveWarning(editor))
+					}
+				}
+				display.RenderWithPrompt(inputPrompt, inputBuffer)
+				continue
+			}
+
+			if ev.Key == termbox.KeyCtrlE {
+				inputMode = true
+				inputPrompt = "Command: "
+				inputBuffer = ""
+				inputSubmit = func(command string) {
+					message, err := ExecuteEditorCommand(editor, command)
+					if err != nil {
+						message = err.Error()
+					}
+					display.SetMessage(message)
+				}
 				display.RenderWithPrompt(inputPrompt, inputBuffer)
 				continue
 			}
@@ -153,16 +728,68 @@ func main() {
 			case termbox.KeyDelete:
 				editor.Delete()
 			case termbox.KeyEnter:
-				editor.InsertAtCursor("\n")
+				editor.TypeAtCursor("\n")
 			case termbox.KeySpace:
-				editor.InsertAtCursor(" ")
+				editor.TypeAtCursor(" ")
 			default:
 				if ev.Ch != 0 {
-					editor.InsertAtCursor(string(ev.Ch))
+					editor.TypeAtCursor(string(ev.Ch))
 				}
 			}
 
 			display.Render()
 		}
 	}
+
+	// Each buffer was saved or deliberately abandoned as it was quit, so
+	// its swap has done its job and is gone.
+	if stdinEditor == nil {
+		return
+	}
+	if toStdout {
+		// Restore the terminal before anything follows in the pipeline.
+		display.Close()
+		if err := stdinEditor.WriteBufferTo(os.Stdout); err != nil {
+			log.Fatalf("Failed to write standard output: %v", err)
+		}
+	}
+	stdinEditor.Close()
+}
+
+// saveWarning describes what went wrong besides the file itself after a
+// successful save, or returns "".
+func saveWarning(editor *Editor) string {
+	if err := editor.UndoHistoryError(); err != nil {
+		return "Saved, but the undo history was not: " + err.Error()
+	}
+	return ""
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// findPrompt labels the find prompt with the search options that are on and
+// with a note such as "no matches".
+func findPrompt(options SearchOptions, note string) string {
+	var labels []string
+	if options.IgnoreCase {
+		labels = append(labels, "ignore case")
+	}
+	if options.WholeWord {
+		labels = append(labels, "whole word")
+	}
+	if options.Regexp {
+		labels = append(labels, "regexp")
+	}
+	if note != "" {
+		labels = append(labels, note)
+	}
+
+	if len(labels) == 0 {
+		return "Find (^T case, ^W word, ^R regexp): "
+	}
+	return "Find [" + strings.Join(labels, ", ") + "]: "
 }
@@ -0,0 +1,145 @@
+package main
+
+// runeIteratorWindow is how many runes a RuneIterator reads on each side of
+// the offset it moves to.
+const runeIteratorWindow = 4096
+
+// RuneIterator walks the runes of a PieceTable in either direction, reading
+// straight from the piece buffers. It must not be used after the table has
+// been edited.
+type RuneIterator struct {
+	pt         *PieceTable
+	offset     int
+	chunk      []rune
+	chunkStart int
+}
+
+func (pt *PieceTable) RuneIterator(offset int) *RuneIterator {
+	return &RuneIterator{
+		pt:     pt,
+		offset: max(0, min(offset, pt.Length())),
+	}
+}
+
+func (it *RuneIterator) Offset() int {
+	return it.offset
+}
+
+// Next returns the rune at the current offset and moves past it.
+func (it *RuneIterator) Next() (rune, bool) {
+	if !it.load(it.offset) {
+		return 0, false
+	}
+	r := it.chunk[it.offset-it.chunkStart]
+	it.offset++
+	return r, true
+}
+
+// Prev returns the rune before the current offset and moves onto it.
+func (it *RuneIterator) Prev() (rune, bool) {
+	if it.offset == 0 || !it.load(it.offset-1) {
+		return 0, false
+	}
+	it.offset--
+	return it.chunk[it.offset-it.chunkStart], true
+}
+
+func (it *RuneIterator) load(offset int) bool {
+	if offset >= it.chunkStart && offset < it.chunkStart+len(it.chunk) {
+		return true
+	}
+
+	piece, pieceStart, ok := it.pt.pieceAt(offset)
+	if !ok {
+		return false
+	}
+
+	// Load a window around offset rather than the whole piece, which may be
+	// an entire lazily loaded file.
+	from := max(offset-runeIteratorWindow, pieceStart)
+	to := min(offset+runeIteratorWindow, pieceStart+piece.length)
+	it.chunk = it.pt.runes(piece.bufferType, piece.start+from-pieceStart, piece.start+to-pieceStart)
+	it.chunkStart = from
+	return true
+}
+
+// pieceAt returns the piece containing offset and the document offset of its
+// first rune.
+func (pt *PieceTable) pieceAt(offset int) (Piece, int, bool) {
+	if offset < 0 {
+		return Piece{}, 0, false
+	}
+
+	base := 0
+	n := pt.pieces
+	for n != nil {
+		leftLength := nodeLength(n.left)
+		if offset < leftLength {
+			n = n.left
+			continue
+		}
+
+		offset -= leftLength
+		base += leftLength
+		if offset < n.piece.length {
+			return n.piece, base, true
+		}
+
+		offset -= n.piece.length
+		base += n.piece.length
+		n = n.right
+	}
+
+	return Piece{}, 0, false
+}
+
+// LineIterator walks the lines of a PieceTable in either direction. Lines are
+// returned without their line break.
+type LineIterator struct {
+	pt   *PieceTable
+	line int
+}
+
+// LineIterator starts at the line containing offset, so Next returns that
+// whole line, from its start, and Prev the one before it.
+func (pt *PieceTable) LineIterator(offset int) *LineIterator {
+	offset = max(0, min(offset, pt.Length()))
+	return pt.LineIteratorAt(pt.lineBreaksBefore(offset))
+}
+
+// LineIteratorAt starts at a line number. GetLineCount is past the last line,
+// for walking back from the end.
+func (pt *PieceTable) LineIteratorAt(line int) *LineIterator {
+	return &LineIterator{
+		pt:   pt,
+		line: max(0, min(line, pt.GetLineCount())),
+	}
+}
+
+func (it *LineIterator) Line() int {
+	return it.line
+}
+
+// Next returns the current line and moves to the one after it.
+func (it *LineIterator) Next() (string, bool) {
+	if it.line >= it.pt.GetLineCount() {
+		return "", false
+	}
+	text := it.text(it.line)
+	it.line++
+	return text, true
+}
+
+// Prev returns the line before the current one and moves onto it.
+func (it *LineIterator) Prev() (string, bool) {
+	if it.line == 0 {
+		return "", false
+	}
+	it.line--
+	return it.text(it.line), true
+}
+
+func (it *LineIterator) text(line int) string {
+	start := it.pt.lineStart(line)
+	return it.pt.Substring(start, start+it.pt.GetLineLength(line))
+}
@@ -0,0 +1,128 @@
+package main
+
+import "testing"
+
+func TestRuneIterator_Next_WalksAcrossPieces(t *testing.T) {
+	pt := NewPieceTable("Hello World")
+	pt.Insert(5, ",")
+	pt.Delete(7, 2)
+
+	it := pt.RuneIterator(3)
+	result := []rune{}
+	for r, ok := it.Next(); ok; r, ok = it.Next() {
+		result = append(result, r)
+	}
+
+	if string(result) != "lo, rld" {
+		t.Errorf("Expected 'lo, rld', got '%s'", string(result))
+	}
+
+	if it.Offset() != pt.Length() {
+		t.Errorf("Expected offset %d at end, got %d", pt.Length(), it.Offset())
+	}
+}
+
+func TestRuneIterator_Prev_WalksBackwards(t *testing.T) {
+	pt := NewPieceTable("abc")
+	pt.Insert(3, "世界")
+
+	it := pt.RuneIterator(pt.Length())
+	result := []rune{}
+	for r, ok := it.Prev(); ok; r, ok = it.Prev() {
+		result = append(result, r)
+	}
+
+	if string(result) != "界世cba" {
+		t.Errorf("Expected '界世cba', got '%s'", string(result))
+	}
+
+	if it.Offset() != 0 {
+		t.Errorf("Expected offset 0 at start, got %d", it.Offset())
+	}
+}
+
+func TestRuneIterator_MixedDirections(t *testing.T) {
+	pt := NewPieceTable("ac")
+	pt.Insert(1, "b")
+
+	it := pt.RuneIterator(1)
+	if r, _ := it.Next(); r != 'b' {
+		t.Errorf("Expected 'b', got %q", r)
+	}
+	if r, _ := it.Next(); r != 'c' {
+		t.Errorf("Expected 'c', got %q", r)
+	}
+	if _, ok := it.Next(); ok {
+		t.Error("Expected no rune past the end")
+	}
+	if r, _ := it.Prev(); r != 'c' {
+		t.Errorf("Expected 'c', got %q", r)
+	}
+}
+
+func TestRuneIterator_ClampsOffset(t *testing.T) {
+	pt := NewPieceTable("abc")
+
+	if it := pt.RuneIterator(-5); it.Offset() != 0 {
+		t.Errorf("Expected offset clamped to 0, got %d", it.Offset())
+	}
+	if it := pt.RuneIterator(50); it.Offset() != 3 {
+		t.Errorf("Expected offset clamped to 3, got %d", it.Offset())
+	}
+}
+
+func TestLineIterator_Next_ReturnsLines(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\n")
+	pt.Insert(4, "1.5\n")
+
+	it := pt.LineIteratorAt(1)
+	expected := []string{"1.5", "two", ""}
+	for _, want := range expected {
+		line, ok := it.Next()
+		if !ok || line != want {
+			t.Errorf("Expected %q, got %q (ok=%v)", want, line, ok)
+		}
+	}
+
+	if _, ok := it.Next(); ok {
+		t.Error("Expected no line past the end")
+	}
+}
+
+func TestLineIterator_Prev_ReturnsLinesBackwards(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\nthree")
+
+	it := pt.LineIteratorAt(2)
+	expected := []string{"two", "one"}
+	for _, want := range expected {
+		line, ok := it.Prev()
+		if !ok || line != want {
+			t.Errorf("Expected %q, got %q (ok=%v)", want, line, ok)
+		}
+	}
+
+	if _, ok := it.Prev(); ok {
+		t.Error("Expected no line before the start")
+	}
+
+	if it.Line() != 0 {
+		t.Errorf("Expected line 0, got %d", it.Line())
+	}
+}
+
+func TestLineIterator_StartsAtLineContainingOffset(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\nthree")
+
+	// Offset 5 is inside "two", and 7 is its line break.
+	for _, offset := range []int{5, 7} {
+		it := pt.LineIterator(offset)
+		if line, ok := it.Next(); !ok || line != "two" || it.Line() != 2 {
+			t.Errorf("Offset %d: expected \"two\" then line 2, got %q and line %d", offset, line, it.Line())
+		}
+	}
+
+	it := pt.LineIterator(pt.Length() + 5)
+	if line, _ := it.Next(); line != "three" {
+		t.Errorf("Expected an offset past the end clamped to the last line, got %q", line)
+	}
+}
@@ -1,5 +1,15 @@
 package main
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
 type BufferType int
 
 const (
@@ -11,102 +21,245 @@ type Piece struct {
 	bufferType BufferType
 	start      int
 	length     int
+	lineBreaks int
 }
 
+// PieceTable stores text as runes, and every offset and length it takes or
+// returns counts runes, never bytes. Callers holding Go strings must convert
+// with utf8.RuneCountInString rather than len.
+//
+// PieceTable keeps, for each backing buffer, the sorted offsets of every '\n'
+// in it. Pieces cache how many of those fall inside them, and the piece tree
+// sums lengths and line breaks per subtree, so offset and line lookups descend
+// the tree and binary search the break offsets instead of scanning text.
+//
+// The original buffer is either held in memory or, for large files, read from
+// the file on demand through originalFile.
 type PieceTable struct {
-	original []rune
-	add      []rune
-	pieces   []Piece
+	original           []rune
+	originalFile       *fileBuffer
+	add                []rune
+	originalLineBreaks []int
+	addLineBreaks      []int
+	pieces             *pieceNode
+	listeners          []*ChangeListener
 }
 
+// ChangeListener is told about every edit after it is applied: inserted is
+// the text placed at offset, and deleted is how many runes were removed there.
+type ChangeListener func(offset int, inserted string, deleted int)
+
 func NewPieceTable(text string) *PieceTable {
 	pt := &PieceTable{
 		original: []rune(text),
 		add:      []rune{},
-		pieces:   []Piece{},
 	}
+	pt.originalLineBreaks = appendLineBreaks(nil, pt.original, 0)
 
 	if len(text) > 0 {
-		pt.pieces = append(pt.pieces, Piece{
-			bufferType: Original,
-			start:      0,
-			length:     len(pt.original),
-		})
+		pt.pieces = newPieceNode(nil, pt.newPiece(Original, 0, len(pt.original)), nil)
 	}
 
 	return pt
 }
 
-func (pt *PieceTable) String() string {
-	totalLength := 0
-	for _, piece := range pt.pieces {
-		totalLength += piece.length
-	}
-
-	result := make([]rune, 0, totalLength)
-	for _, piece := range pt.pieces {
-		var buffer []rune
-		if piece.bufferType == Original {
-			buffer = pt.original
-		} else {
-			buffer = pt.add
+// newPieceTableFromFile returns a table whose original text is read lazily
+// from fb.
+func newPieceTableFromFile(fb *fileBuffer) *PieceTable {
+	pt := &PieceTable{
+		originalFile: fb,
+		add:          []rune{},
+	}
+	if fb.Len() > 0 {
+		pt.pieces = newPieceNode(nil, pt.newPiece(Original, 0, fb.Len()), nil)
+	}
+	return pt
+}
+
+// Close releases the file behind a lazily loaded original buffer.
+func (pt *PieceTable) Close() error {
+	if pt.originalFile == nil {
+		return nil
+	}
+	return pt.originalFile.Close()
+}
+
+// Err returns ErrFileRewritten once the file behind a lazily loaded original
+// buffer has been changed in place, after which the text can't be trusted.
+func (pt *PieceTable) Err() error {
+	if pt.originalFile == nil {
+		return nil
+	}
+	return pt.originalFile.check()
+}
+
+// reset replaces the text with other's, taking over its backing buffers and
+// closing the file behind the old text. Listeners are told the old text was
+// deleted, but not given the new text, which may be far too large to hold as
+// a string. other must not be used afterwards.
+func (pt *PieceTable) reset(other *PieceTable) {
+	deleted := pt.Length()
+	pt.Close()
+	listeners := pt.listeners
+	*pt = *other
+	pt.listeners = listeners
+	pt.notify(0, "", deleted)
+}
+
+func appendLineBreaks(breaks []int, text []rune, base int) []int {
+	for i, r := range text {
+		if r == '\n' {
+			breaks = append(breaks, base+i)
 		}
+	}
+	return breaks
+}
 
-		result = append(result, buffer[piece.start:piece.start+piece.length]...)
+// runes returns the runes in [start, end) of a backing buffer. The result
+// must not be modified.
+func (pt *PieceTable) runes(bufferType BufferType, start, end int) []rune {
+	if bufferType == Add {
+		return pt.add[start:end]
 	}
+	if pt.originalFile != nil {
+		return pt.originalFile.Runes(start, end)
+	}
+	return pt.original[start:end]
+}
 
-	return string(result)
+// bufferBreaksBefore counts the line breaks in [0, offset) of a backing
+// buffer.
+func (pt *PieceTable) bufferBreaksBefore(bufferType BufferType, offset int) int {
+	if bufferType == Add {
+		return sort.SearchInts(pt.addLineBreaks, offset)
+	}
+	if pt.originalFile != nil {
+		return pt.originalFile.LineBreaksBefore(offset)
+	}
+	return sort.SearchInts(pt.originalLineBreaks, offset)
 }
 
-func (pt *PieceTable) Length() int {
-	totalLength := 0
-	for _, piece := range pt.pieces {
-		totalLength += piece.length
+// bufferLineBreak returns the offset of the n-th (0-based) line break in a
+// backing buffer.
+func (pt *PieceTable) bufferLineBreak(bufferType BufferType, n int) int {
+	if bufferType == Add {
+		return pt.addLineBreaks[n]
+	}
+	if pt.originalFile != nil {
+		return pt.originalFile.LineBreak(n)
 	}
-	return totalLength
+	return pt.originalLineBreaks[n]
 }
 
-func (pt *PieceTable) Substring(start, end int) string {
-	if start < 0 || end > pt.Length() || start > end {
-		return ""
+func (pt *PieceTable) newPiece(bufferType BufferType, start, length int) Piece {
+	first := pt.bufferBreaksBefore(bufferType, start)
+	last := pt.bufferBreaksBefore(bufferType, start+length)
+	return Piece{
+		bufferType: bufferType,
+		start:      start,
+		length:     length,
+		lineBreaks: last - first,
 	}
+}
 
-	result := make([]rune, 0, end-start)
-	currentPos := 0
+// nthLineBreak returns the offset within the piece of its n-th (0-based) line
+// break.
+func (pt *PieceTable) nthLineBreak(piece Piece, n int) int {
+	first := pt.bufferBreaksBefore(piece.bufferType, piece.start)
+	return pt.bufferLineBreak(piece.bufferType, first+n) - piece.start
+}
 
-	for _, piece := range pt.pieces {
-		pieceEnd := currentPos + piece.length
+func (pt *PieceTable) String() string {
+	return pt.Substring(0, pt.Length())
+}
 
-		if currentPos >= end {
-			break
-		}
+// Hash returns the SHA-256 of the text, as contentHash(pt.String()) would,
+// without building the whole string.
+func (pt *PieceTable) Hash() string {
+	if pt.originalFile != nil && nodeCount(pt.pieces) == 1 &&
+		pt.pieces.piece.bufferType == Original && pt.pieces.piece.length == pt.originalFile.Len() {
+		return pt.originalFile.textHash
+	}
 
-		if pieceEnd <= start {
-			currentPos = pieceEnd
-			continue
-		}
+	h := sha256.New()
+	pt.WriteTo(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-		var buffer []rune
-		if piece.bufferType == Original {
-			buffer = pt.original
-		} else {
-			buffer = pt.add
-		}
+// writeWindow is how many runes WriteTo encodes per Write call.
+const writeWindow = 64 << 10
+
+// WriteTo writes the text to w as UTF-8 a window of runes at a time, so the
+// whole document is never built in memory. Each Write holds whole runes. It
+// fails with Err if the file behind the text was rewritten meanwhile, as what
+// was written can't be trusted.
+func (pt *PieceTable) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var err error
+	buf := make([]byte, 0, writeWindow)
+	walkPieces(pt.pieces, 0, 0, pt.Length(), func(piece Piece, _ int) bool {
+		for from := piece.start; from < piece.start+piece.length; from += writeWindow {
+			to := min(from+writeWindow, piece.start+piece.length)
+			buf = buf[:0]
+			for _, r := range pt.runes(piece.bufferType, from, to) {
+				buf = utf8.AppendRune(buf, r)
+			}
 
-		pieceStart := 0
-		if start > currentPos {
-			pieceStart = start - currentPos
+			var n int
+			n, err = w.Write(buf)
+			written += int64(n)
+			if err != nil {
+				return false
+			}
 		}
+		return true
+	})
+	if err == nil {
+		err = pt.Err()
+	}
+	return written, err
+}
 
-		pieceEndInBuffer := piece.length
-		if end < pieceEnd {
-			pieceEndInBuffer = piece.length - (pieceEnd - end)
-		}
+// clone returns an independent copy of the table that shares its backing
+// buffers, so trial edits can be made without touching the original.
+func (pt *PieceTable) clone() *PieceTable {
+	return &PieceTable{
+		original:           pt.original,
+		originalFile:       pt.originalFile,
+		add:                pt.add[:len(pt.add):len(pt.add)],
+		originalLineBreaks: pt.originalLineBreaks,
+		addLineBreaks:      pt.addLineBreaks[:len(pt.addLineBreaks):len(pt.addLineBreaks)],
+		pieces:             clonePieces(pt.pieces),
+	}
+}
 
-		result = append(result, buffer[piece.start+pieceStart:piece.start+pieceEndInBuffer]...)
-		currentPos = pieceEnd
+func (pt *PieceTable) Length() int {
+	return nodeLength(pt.pieces)
+}
+
+// pieceList returns the pieces in document order.
+func (pt *PieceTable) pieceList() []Piece {
+	pieces := make([]Piece, 0, nodeCount(pt.pieces))
+	walkPieces(pt.pieces, 0, 0, pt.Length(), func(piece Piece, _ int) bool {
+		pieces = append(pieces, piece)
+		return true
+	})
+	return pieces
+}
+
+func (pt *PieceTable) Substring(start, end int) string {
+	if start < 0 || end > pt.Length() || start > end {
+		return ""
 	}
 
+	result := make([]rune, 0, end-start)
+	walkPieces(pt.pieces, 0, start, end, func(piece Piece, pieceStart int) bool {
+		from := piece.start + max(start-pieceStart, 0)
+		to := piece.start + min(end-pieceStart, piece.length)
+		result = append(result, pt.runes(piece.bufferType, from, to)...)
+		return true
+	})
+
 	return string(result)
 }
 
@@ -116,186 +269,188 @@ func (pt *PieceTable) Insert(offset int, text string) {
 	}
 
 	addStart := len(pt.add)
-	pt.add = append(pt.add, []rune(text)...)
-	textLength := len([]rune(text))
+	runes := []rune(text)
+	pt.add = append(pt.add, runes...)
+	pt.addLineBreaks = appendLineBreaks(pt.addLineBreaks, runes, addStart)
+
+	offset = max(0, min(offset, pt.Length()))
+	newPiece := pt.newPiece(Add, addStart, len(runes))
+	left, right := pt.splitPieces(pt.pieces, offset)
+	pt.pieces = joinPieces(left, newPiece, right)
+	pt.notify(offset, text, 0)
+}
 
-	newPiece := Piece{
-		bufferType: Add,
-		start:      addStart,
-		length:     textLength,
+func (pt *PieceTable) Delete(offset, length int) {
+	if offset < 0 {
+		length += offset
+		offset = 0
+	}
+	length = min(length, pt.Length()-offset)
+	if length <= 0 {
+		return
 	}
 
-	currentPos := 0
-	for i, piece := range pt.pieces {
-		pieceEnd := currentPos + piece.length
+	left, rest := pt.splitPieces(pt.pieces, offset)
+	_, right := pt.splitPieces(rest, length)
+	pt.pieces = concatPieces(left, right)
+	pt.notify(offset, "", length)
+}
 
-		if offset == currentPos {
-			pt.pieces = append(pt.pieces[:i], append([]Piece{newPiece}, pt.pieces[i:]...)...)
-			return
-		}
+// AddChangeListener calls listener after every edit until the returned
+// function is called to remove it.
+func (pt *PieceTable) AddChangeListener(listener ChangeListener) (remove func()) {
+	added := &listener
+	pt.listeners = append(pt.listeners, added)
+	return func() {
+		pt.listeners = slices.DeleteFunc(pt.listeners, func(l *ChangeListener) bool {
+			return l == added
+		})
+	}
+}
 
-		if offset > currentPos && offset < pieceEnd {
-			splitAt := offset - currentPos
+func (pt *PieceTable) notify(offset int, inserted string, deleted int) {
+	for _, listener := range pt.listeners {
+		(*listener)(offset, inserted, deleted)
+	}
+}
 
-			leftPiece := Piece{
-				bufferType: piece.bufferType,
-				start:      piece.start,
-				length:     splitAt,
-			}
+// lineBreaksBefore counts the line breaks in [0, offset).
+func (pt *PieceTable) lineBreaksBefore(offset int) int {
+	count := 0
+	n := pt.pieces
 
-			rightPiece := Piece{
-				bufferType: piece.bufferType,
-				start:      piece.start + splitAt,
-				length:     piece.length - splitAt,
-			}
+	for n != nil {
+		leftLength := nodeLength(n.left)
+		if offset <= leftLength {
+			n = n.left
+			continue
+		}
 
-			pt.pieces = append(pt.pieces[:i], append([]Piece{leftPiece, newPiece, rightPiece}, pt.pieces[i+1:]...)...)
-			return
+		count += nodeLineBreaks(n.left)
+		offset -= leftLength
+		if offset < n.piece.length {
+			partial := pt.newPiece(n.piece.bufferType, n.piece.start, offset)
+			return count + partial.lineBreaks
 		}
 
-		currentPos = pieceEnd
+		count += n.piece.lineBreaks
+		offset -= n.piece.length
+		n = n.right
 	}
 
-	pt.pieces = append(pt.pieces, newPiece)
+	return count
 }
 
-func (pt *PieceTable) Delete(offset, length int) {
-	if length == 0 {
-		return
+// lineStart returns the offset of the first rune of the given line. Lines past
+// the end of the buffer start at Length().
+func (pt *PieceTable) lineStart(line int) int {
+	if line <= 0 {
+		return 0
+	}
+	if line > pt.lineBreakCount() {
+		return pt.Length()
 	}
 
-	deleteEnd := offset + length
+	remaining := line
 	currentPos := 0
-	newPieces := []Piece{}
+	n := pt.pieces
 
-	for _, piece := range pt.pieces {
-		pieceStart := currentPos
-		pieceEnd := currentPos + piece.length
-
-		if pieceEnd <= offset {
-			newPieces = append(newPieces, piece)
-			currentPos = pieceEnd
-			continue
-		}
-
-		if pieceStart >= deleteEnd {
-			newPieces = append(newPieces, piece)
-			currentPos = pieceEnd
+	for n != nil {
+		if remaining <= nodeLineBreaks(n.left) {
+			n = n.left
 			continue
 		}
 
-		overlapStart := max(pieceStart, offset)
-		overlapEnd := min(pieceEnd, deleteEnd)
-
-		if overlapStart > pieceStart {
-			leftLength := overlapStart - pieceStart
-			newPieces = append(newPieces, Piece{
-				bufferType: piece.bufferType,
-				start:      piece.start,
-				length:     leftLength,
-			})
-		}
-
-		if overlapEnd < pieceEnd {
-			rightStart := piece.start + (overlapEnd - pieceStart)
-			rightLength := pieceEnd - overlapEnd
-			newPieces = append(newPieces, Piece{
-				bufferType: piece.bufferType,
-				start:      rightStart,
-				length:     rightLength,
-			})
+		remaining -= nodeLineBreaks(n.left)
+		currentPos += nodeLength(n.left)
+		if remaining <= n.piece.lineBreaks {
+			return currentPos + pt.nthLineBreak(n.piece, remaining-1) + 1
 		}
 
-		currentPos = pieceEnd
+		remaining -= n.piece.lineBreaks
+		currentPos += n.piece.length
+		n = n.right
 	}
 
-	pt.pieces = newPieces
+	return currentPos
 }
 
-func (pt *PieceTable) GetLineColumn(offset int) (line, col int) {
-	text := []rune(pt.String())
-	if offset > len(text) {
-		offset = len(text)
-	}
-
-	line = 0
-	col = 0
+func (pt *PieceTable) lineBreakCount() int {
+	return nodeLineBreaks(pt.pieces)
+}
 
-	for i := 0; i < offset; i++ {
-		if text[i] == '\n' {
-			line++
-			col = 0
-		} else {
-			col++
-		}
+// GetLineColumn returns the line of offset and its display column, counting
+// wide characters as two columns and each grapheme cluster as a unit.
+func (pt *PieceTable) GetLineColumn(offset int) (line, col int) {
+	offset = min(offset, pt.Length())
+	if offset <= 0 {
+		return 0, 0
 	}
 
+	line = pt.lineBreaksBefore(offset)
+	pt.forEachGrapheme(pt.lineStart(line), offset, func(_ int, cluster []rune) bool {
+		col += graphemeWidth(cluster)
+		return true
+	})
 	return line, col
 }
 
+// GetOffsetFromLineColumn returns the offset of the cluster at the given
+// display column, or of the line end when the line is shorter. A column
+// inside a wide character resolves to the start of that character.
 func (pt *PieceTable) GetOffsetFromLineColumn(targetLine, targetCol int) int {
-	text := []rune(pt.String())
-	line := 0
-	col := 0
-
-	for i := 0; i <= len(text); i++ {
-		if line == targetLine && col == targetCol {
-			return i
-		}
-
-		if i == len(text) {
-			break
-		}
-
-		if text[i] == '\n' {
-			if line == targetLine {
-				return i
-			}
-			line++
-			col = 0
-		} else {
-			col++
-		}
+	if targetLine < 0 || targetLine >= pt.GetLineCount() {
+		return pt.Length()
 	}
 
-	return len(text)
+	start := pt.lineStart(targetLine)
+	end := start + pt.GetLineLength(targetLine)
+	offset := end
+	col := 0
+	pt.forEachGrapheme(start, end, func(clusterStart int, cluster []rune) bool {
+		col += graphemeWidth(cluster)
+		if col > targetCol {
+			offset = clusterStart
+			return false
+		}
+		return true
+	})
+	return offset
 }
 
+// GetLineLength returns the number of runes on a line, excluding its line
+// break.
 func (pt *PieceTable) GetLineLength(lineNum int) int {
-	text := []rune(pt.String())
-	line := 0
-	lineStart := 0
-
-	for i := 0; i <= len(text); i++ {
-		if line == lineNum {
-			if i == len(text) || text[i] == '\n' {
-				return i - lineStart
-			}
-		}
-
-		if i < len(text) && text[i] == '\n' {
-			if line == lineNum {
-				return i - lineStart
-			}
-			line++
-			lineStart = i + 1
-		}
+	lineCount := pt.GetLineCount()
+	if lineNum < 0 || lineNum >= lineCount {
+		return 0
 	}
 
-	return 0
+	start := pt.lineStart(lineNum)
+	if lineNum == lineCount-1 {
+		return pt.Length() - start
+	}
+	return pt.lineStart(lineNum+1) - 1 - start
 }
 
 func (pt *PieceTable) GetLineCount() int {
-	text := []rune(pt.String())
-	if len(text) == 0 {
-		return 1
+	return pt.lineBreakCount() + 1
+}
+
+// Lines returns the text of lines [from, to) without their line breaks. The
+// range is clamped to the lines that exist.
+func (pt *PieceTable) Lines(from, to int) []string {
+	lineCount := pt.GetLineCount()
+	from = max(from, 0)
+	to = min(to, lineCount)
+	if from >= to {
+		return nil
 	}
 
-	lines := 1
-	for _, r := range text {
-		if r == '\n' {
-			lines++
-		}
+	end := pt.Length()
+	if to < lineCount {
+		end = pt.lineStart(to) - 1
 	}
-	return lines
+
+	return strings.Split(pt.Substring(pt.lineStart(from), end), "\n")
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -16,11 +17,11 @@ func TestNewPieceTable_WithText(t *testing.T) {
 		t.Errorf("Expected add buffer to be empty, got length %d", len(pt.add))
 	}
 
-	if len(pt.pieces) != 1 {
-		t.Errorf("Expected 1 piece, got %d", len(pt.pieces))
+	if len(pt.pieceList()) != 1 {
+		t.Errorf("Expected 1 piece, got %d", len(pt.pieceList()))
 	}
 
-	piece := pt.pieces[0]
+	piece := pt.pieceList()[0]
 	if piece.bufferType != Original {
 		t.Errorf("Expected piece to reference Original buffer, got %v", piece.bufferType)
 	}
@@ -45,8 +46,8 @@ func TestNewPieceTable_EmptyText(t *testing.T) {
 		t.Errorf("Expected add buffer to be empty, got length %d", len(pt.add))
 	}
 
-	if len(pt.pieces) != 0 {
-		t.Errorf("Expected 0 pieces, got %d", len(pt.pieces))
+	if len(pt.pieceList()) != 0 {
+		t.Errorf("Expected 0 pieces, got %d", len(pt.pieceList()))
 	}
 }
 
@@ -63,8 +64,8 @@ func TestNewPieceTable_UnicodeText(t *testing.T) {
 		t.Errorf("Expected %d runes, got %d", expectedRuneCount, len(pt.original))
 	}
 
-	if pt.pieces[0].length != expectedRuneCount {
-		t.Errorf("Expected piece length to be %d, got %d", expectedRuneCount, pt.pieces[0].length)
+	if pt.pieceList()[0].length != expectedRuneCount {
+		t.Errorf("Expected piece length to be %d, got %d", expectedRuneCount, pt.pieceList()[0].length)
 	}
 }
 
@@ -330,3 +331,163 @@ func TestPieceTable_Substring_InvalidRange(t *testing.T) {
 		t.Errorf("Expected empty string for start > end, got '%s'", result)
 	}
 }
+
+func TestPieceTable_GetLineCount_AfterEdits(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\nthree")
+
+	if pt.GetLineCount() != 3 {
+		t.Errorf("Expected 3 lines, got %d", pt.GetLineCount())
+	}
+
+	pt.Insert(4, "inserted\nlines\n")
+	if pt.GetLineCount() != 5 {
+		t.Errorf("Expected 5 lines after insert, got %d", pt.GetLineCount())
+	}
+
+	pt.Delete(3, 9)
+	if pt.GetLineCount() != 4 {
+		t.Errorf("Expected 4 lines after delete, got %d", pt.GetLineCount())
+	}
+}
+
+func TestPieceTable_GetLineColumn_AcrossPieces(t *testing.T) {
+	pt := NewPieceTable("ab\ncd")
+	pt.Insert(4, "x\ny")
+
+	// Text is now "ab\ncx\nyd".
+	tests := []struct {
+		offset int
+		line   int
+		col    int
+	}{
+		{0, 0, 0},
+		{2, 0, 2},
+		{3, 1, 0},
+		{5, 1, 2},
+		{6, 2, 0},
+		{8, 2, 2},
+		{100, 2, 2},
+	}
+
+	for _, tt := range tests {
+		line, col := pt.GetLineColumn(tt.offset)
+		if line != tt.line || col != tt.col {
+			t.Errorf("Offset %d: expected (%d, %d), got (%d, %d)", tt.offset, tt.line, tt.col, line, col)
+		}
+	}
+}
+
+func TestPieceTable_GetOffsetFromLineColumn_AcrossPieces(t *testing.T) {
+	pt := NewPieceTable("ab\ncd")
+	pt.Insert(4, "x\ny")
+
+	if offset := pt.GetOffsetFromLineColumn(1, 1); offset != 4 {
+		t.Errorf("Expected offset 4, got %d", offset)
+	}
+
+	if offset := pt.GetOffsetFromLineColumn(1, 10); offset != 5 {
+		t.Errorf("Expected column clamped to line end at 5, got %d", offset)
+	}
+
+	if offset := pt.GetOffsetFromLineColumn(2, 1); offset != 7 {
+		t.Errorf("Expected offset 7, got %d", offset)
+	}
+
+	if offset := pt.GetOffsetFromLineColumn(5, 0); offset != 8 {
+		t.Errorf("Expected offset past last line to be 8, got %d", offset)
+	}
+}
+
+func TestPieceTable_GetLineLength_AfterDeleteJoinsLines(t *testing.T) {
+	pt := NewPieceTable("hello\nworld\n")
+	pt.Delete(5, 1)
+
+	if pt.GetLineLength(0) != 10 {
+		t.Errorf("Expected joined line length 10, got %d", pt.GetLineLength(0))
+	}
+
+	if pt.GetLineLength(1) != 0 {
+		t.Errorf("Expected trailing empty line length 0, got %d", pt.GetLineLength(1))
+	}
+
+	if pt.GetLineLength(2) != 0 {
+		t.Errorf("Expected out of range line length 0, got %d", pt.GetLineLength(2))
+	}
+}
+
+func TestPieceTable_Lines_ReturnsRange(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\nthree\nfour")
+	pt.Insert(8, "2.5\n")
+
+	lines := pt.Lines(1, 4)
+	expected := []string{"two", "2.5", "three"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestPieceTable_Lines_ClampsToLineCount(t *testing.T) {
+	pt := NewPieceTable("one\ntwo\n")
+
+	lines := pt.Lines(-3, 100)
+	expected := []string{"one", "two", ""}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+
+	if lines := pt.Lines(5, 10); lines != nil {
+		t.Errorf("Expected nil for range past the end, got %q", lines)
+	}
+}
+
+func TestPieceTable_Lines_EmptyBuffer(t *testing.T) {
+	pt := NewPieceTable("")
+
+	lines := pt.Lines(0, 10)
+	if len(lines) != 1 || lines[0] != "" {
+		t.Errorf("Expected a single empty line, got %q", lines)
+	}
+}
+
+func TestPieceTable_WriteTo_MatchesString(t *testing.T) {
+	pt := NewPieceTable("Hello 世界\n")
+	pt.Insert(6, "wide ")
+	pt.Insert(pt.Length(), "🙂 end")
+	pt.Delete(0, 1)
+
+	var sb strings.Builder
+	n, err := pt.WriteTo(&sb)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if sb.String() != pt.String() {
+		t.Errorf("Expected %q, got %q", pt.String(), sb.String())
+	}
+	if n != int64(len(pt.String())) {
+		t.Errorf("Expected %d bytes written, got %d", len(pt.String()), n)
+	}
+}
+
+func TestPieceTable_RemoveChangeListener(t *testing.T) {
+	pt := NewPieceTable("")
+	var first, second int
+	removeFirst := pt.AddChangeListener(func(int, string, int) { first++ })
+	pt.AddChangeListener(func(int, string, int) { second++ })
+
+	pt.Insert(0, "a")
+	removeFirst()
+	pt.Insert(0, "b")
+	if first != 1 || second != 2 {
+		t.Errorf("Expected only the remaining listener told, got %d and %d", first, second)
+	}
+}
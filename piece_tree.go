@@ -0,0 +1,209 @@
+package main
+
+// pieceNode is a node of the AVL tree holding the pieces in document order.
+// Every node caches the total rune length and line break count of its
+// subtree, so offsets and line numbers can be located by descending the tree.
+type pieceNode struct {
+	piece      Piece
+	left       *pieceNode
+	right      *pieceNode
+	height     int
+	length     int
+	lineBreaks int
+}
+
+func newPieceNode(left *pieceNode, piece Piece, right *pieceNode) *pieceNode {
+	n := &pieceNode{
+		piece: piece,
+		left:  left,
+		right: right,
+	}
+	n.update()
+	return n
+}
+
+func (n *pieceNode) update() {
+	n.height = max(nodeHeight(n.left), nodeHeight(n.right)) + 1
+	n.length = nodeLength(n.left) + n.piece.length + nodeLength(n.right)
+	n.lineBreaks = nodeLineBreaks(n.left) + n.piece.lineBreaks + nodeLineBreaks(n.right)
+}
+
+func nodeHeight(n *pieceNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func nodeLength(n *pieceNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.length
+}
+
+func nodeLineBreaks(n *pieceNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.lineBreaks
+}
+
+func nodeCount(n *pieceNode) int {
+	if n == nil {
+		return 0
+	}
+	return nodeCount(n.left) + 1 + nodeCount(n.right)
+}
+
+func rotateLeft(n *pieceNode) *pieceNode {
+	r := n.right
+	n.right = r.left
+	n.update()
+	r.left = n
+	r.update()
+	return r
+}
+
+func rotateRight(n *pieceNode) *pieceNode {
+	l := n.left
+	n.left = l.right
+	n.update()
+	l.right = n
+	l.update()
+	return l
+}
+
+// joinPieces returns a balanced tree holding left, then piece, then right.
+// Both subtrees must already be balanced.
+func joinPieces(left *pieceNode, piece Piece, right *pieceNode) *pieceNode {
+	switch {
+	case nodeHeight(left) > nodeHeight(right)+1:
+		return joinRight(left, piece, right)
+	case nodeHeight(right) > nodeHeight(left)+1:
+		return joinLeft(left, piece, right)
+	default:
+		return newPieceNode(left, piece, right)
+	}
+}
+
+func joinRight(left *pieceNode, piece Piece, right *pieceNode) *pieceNode {
+	if nodeHeight(left.right) <= nodeHeight(right)+1 {
+		joined := newPieceNode(left.right, piece, right)
+		left.right = joined
+		if nodeHeight(joined) <= nodeHeight(left.left)+1 {
+			left.update()
+			return left
+		}
+		left.right = rotateRight(joined)
+		left.update()
+		return rotateLeft(left)
+	}
+
+	left.right = joinRight(left.right, piece, right)
+	left.update()
+	if nodeHeight(left.right) <= nodeHeight(left.left)+1 {
+		return left
+	}
+	return rotateLeft(left)
+}
+
+func joinLeft(left *pieceNode, piece Piece, right *pieceNode) *pieceNode {
+	if nodeHeight(right.left) <= nodeHeight(left)+1 {
+		joined := newPieceNode(left, piece, right.left)
+		right.left = joined
+		if nodeHeight(joined) <= nodeHeight(right.right)+1 {
+			right.update()
+			return right
+		}
+		right.left = rotateLeft(joined)
+		right.update()
+		return rotateRight(right)
+	}
+
+	right.left = joinLeft(left, piece, right.left)
+	right.update()
+	if nodeHeight(right.left) <= nodeHeight(right.right)+1 {
+		return right
+	}
+	return rotateRight(right)
+}
+
+// splitLastPiece removes the last piece of a non-empty tree.
+func splitLastPiece(n *pieceNode) (*pieceNode, Piece) {
+	if n.right == nil {
+		return n.left, n.piece
+	}
+	rest, last := splitLastPiece(n.right)
+	return joinPieces(n.left, n.piece, rest), last
+}
+
+func concatPieces(left, right *pieceNode) *pieceNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	rest, last := splitLastPiece(left)
+	return joinPieces(rest, last, right)
+}
+
+// splitPieces divides the tree at a rune offset, cutting the piece that
+// straddles the offset in two.
+func (pt *PieceTable) splitPieces(n *pieceNode, offset int) (*pieceNode, *pieceNode) {
+	if n == nil {
+		return nil, nil
+	}
+
+	leftLength := nodeLength(n.left)
+	pieceEnd := leftLength + n.piece.length
+
+	switch {
+	case offset <= leftLength:
+		left, right := pt.splitPieces(n.left, offset)
+		return left, joinPieces(right, n.piece, n.right)
+	case offset >= pieceEnd:
+		left, right := pt.splitPieces(n.right, offset-pieceEnd)
+		return joinPieces(n.left, n.piece, left), right
+	default:
+		splitAt := offset - leftLength
+		leftPiece := pt.newPiece(n.piece.bufferType, n.piece.start, splitAt)
+		rightPiece := pt.newPiece(n.piece.bufferType, n.piece.start+splitAt, n.piece.length-splitAt)
+		return joinPieces(n.left, leftPiece, nil), joinPieces(nil, rightPiece, n.right)
+	}
+}
+
+// walkPieces calls fn, in document order, for every piece overlapping
+// [start, end). base is the document offset of the subtree's first rune.
+// Walking stops early when fn returns false.
+func walkPieces(n *pieceNode, base, start, end int, fn func(piece Piece, pieceStart int) bool) bool {
+	if n == nil || base >= end || base+n.length <= start {
+		return true
+	}
+
+	if !walkPieces(n.left, base, start, end, fn) {
+		return false
+	}
+
+	pieceStart := base + nodeLength(n.left)
+	if pieceStart < end && pieceStart+n.piece.length > start {
+		if !fn(n.piece, pieceStart) {
+			return false
+		}
+	}
+
+	return walkPieces(n.right, pieceStart+n.piece.length, start, end, fn)
+}
+
+// clonePieces copies a tree so the copy can be split and joined without
+// affecting the original.
+func clonePieces(n *pieceNode) *pieceNode {
+	if n == nil {
+		return nil
+	}
+	copied := *n
+	copied.left = clonePieces(n.left)
+	copied.right = clonePieces(n.right)
+	return &copied
+}
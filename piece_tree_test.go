@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func checkPieceTree(t *testing.T, n *pieceNode) {
+	t.Helper()
+	if n == nil {
+		return
+	}
+
+	checkPieceTree(t, n.left)
+	checkPieceTree(t, n.right)
+
+	balance := nodeHeight(n.left) - nodeHeight(n.right)
+	if balance < -1 || balance > 1 {
+		t.Fatalf("Expected balanced node, got balance factor %d", balance)
+	}
+
+	if n.length != nodeLength(n.left)+n.piece.length+nodeLength(n.right) {
+		t.Fatalf("Expected cached length to match children, got %d", n.length)
+	}
+
+	if n.lineBreaks != nodeLineBreaks(n.left)+n.piece.lineBreaks+nodeLineBreaks(n.right) {
+		t.Fatalf("Expected cached line breaks to match children, got %d", n.lineBreaks)
+	}
+}
+
+func TestPieceTree_ManyInserts_StaysBalanced(t *testing.T) {
+	pt := NewPieceTable("")
+	for i := 0; i < 1000; i++ {
+		pt.Insert(pt.Length()/2, "ab\n")
+	}
+
+	checkPieceTree(t, pt.pieces)
+
+	if nodeHeight(pt.pieces) > 20 {
+		t.Errorf("Expected height to stay logarithmic, got %d", nodeHeight(pt.pieces))
+	}
+
+	if pt.GetLineCount() != 1001 {
+		t.Errorf("Expected 1001 lines, got %d", pt.GetLineCount())
+	}
+}
+
+func TestPieceTree_ManyDeletes_StaysBalanced(t *testing.T) {
+	pt := NewPieceTable("")
+	for i := 0; i < 500; i++ {
+		pt.Insert(i, "x")
+	}
+
+	for pt.Length() > 10 {
+		pt.Delete(pt.Length()/3, 7)
+		checkPieceTree(t, pt.pieces)
+	}
+
+	if pt.String() != strings.Repeat("x", pt.Length()) {
+		t.Errorf("Expected only 'x' runes, got %q", pt.String())
+	}
+}
+
+func TestPieceTree_MixedEdits_MatchesString(t *testing.T) {
+	pt := NewPieceTable("The quick\nbrown fox\njumps over\nthe lazy dog")
+	expected := []rune(pt.String())
+
+	seed := uint32(7)
+	next := func(n int) int {
+		seed = seed*1664525 + 1013904223
+		return int(seed>>8) % n
+	}
+
+	for i := 0; i < 300; i++ {
+		offset := next(len(expected) + 1)
+		if i%3 == 0 && len(expected) > 0 {
+			length := min(next(5)+1, len(expected)-offset)
+			pt.Delete(offset, length)
+			expected = append(expected[:offset:offset], expected[offset+length:]...)
+		} else {
+			text := []rune("a\nβ")[:next(3)+1]
+			pt.Insert(offset, string(text))
+			expected = append(expected[:offset:offset], append(text, expected[offset:]...)...)
+		}
+
+		checkPieceTree(t, pt.pieces)
+		if pt.String() != string(expected) {
+			t.Fatalf("Step %d: expected %q, got %q", i, string(expected), pt.String())
+		}
+		if pt.GetLineCount() != strings.Count(string(expected), "\n")+1 {
+			t.Fatalf("Step %d: expected %d lines, got %d", i, strings.Count(string(expected), "\n")+1, pt.GetLineCount())
+		}
+	}
+}
+
+func TestPieceTree_SplitPieces_SplitsInsidePiece(t *testing.T) {
+	pt := NewPieceTable("Hello\nWorld")
+
+	left, right := pt.splitPieces(pt.pieces, 3)
+
+	if nodeLength(left) != 3 || nodeLength(right) != 8 {
+		t.Errorf("Expected lengths 3 and 8, got %d and %d", nodeLength(left), nodeLength(right))
+	}
+
+	if nodeLineBreaks(left) != 0 || nodeLineBreaks(right) != 1 {
+		t.Errorf("Expected line breaks 0 and 1, got %d and %d", nodeLineBreaks(left), nodeLineBreaks(right))
+	}
+}
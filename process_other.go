@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// processRunning cannot check other processes here, so swap files are assumed
+// to be left over from a crash.
+func processRunning(pid int) bool {
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Bytes that cannot be decoded are kept in the buffer as one rune each from
+// the end of the last private use plane, U+10FF00 + byte, and written back
+// unchanged. A file that really contains one of these runes has its bytes
+// escaped the same way, so decoding and encoding always round-trip.
+const rawByteBase = 0x10FF00
+
+func rawByteRune(b byte) rune {
+	return rawByteBase + rune(b)
+}
+
+func rawByteOf(r rune) (byte, bool) {
+	if r < rawByteBase || r > rawByteBase+0xFF {
+		return 0, false
+	}
+	return byte(r - rawByteBase), true
+}
+
+// decodeUTF8Raw decodes UTF-8, escaping invalid bytes instead of replacing
+// them with U+FFFD.
+func decodeUTF8Raw(data []byte) string {
+	if utf8.Valid(data) && !containsRawByteRunes(data) {
+		return string(data)
+	}
+
+	runes := make([]rune, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		_, escaped := rawByteOf(r)
+		if (r == utf8.RuneError && size == 1) || escaped {
+			for _, b := range data[:size] {
+				runes = append(runes, rawByteRune(b))
+			}
+		} else {
+			runes = append(runes, r)
+		}
+		data = data[size:]
+	}
+	return string(runes)
+}
+
+// containsRawByteRunes reports whether valid UTF-8 data holds a rune from the
+// escape range. All of them encode as F4 8F BC-BF xx.
+func containsRawByteRunes(data []byte) bool {
+	for i := 0; i+3 < len(data); i++ {
+		if data[i] == 0xF4 && data[i+1] == 0x8F && data[i+2] >= 0xBC {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeUTF8Raw encodes text as UTF-8, writing escaped bytes back verbatim.
+func encodeUTF8Raw(dst []byte, text string) []byte {
+	for _, r := range text {
+		if b, ok := rawByteOf(r); ok {
+			dst = append(dst, b)
+		} else {
+			dst = utf8.AppendRune(dst, r)
+		}
+	}
+	return dst
+}
+
+// escapedCluster returns how a cluster that cannot be shown as text is
+// displayed: an escaped byte or a control character becomes <0xNN>.
+func escapedCluster(cluster []rune) (string, bool) {
+	if len(cluster) == 0 {
+		return "", false
+	}
+
+	r := cluster[0]
+	if b, ok := rawByteOf(r); ok {
+		return fmt.Sprintf("<0x%02X>", b), true
+	}
+	if (r < 0x20 && r != '\t' && r != '\n') || r == 0x7F {
+		return fmt.Sprintf("<0x%02X>", r), true
+	}
+	return "", false
+}
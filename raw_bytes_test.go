@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRawBytes_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  Encoding
+		data []byte
+	}{
+		{"invalid utf-8", UTF8, []byte("caf\xE9 is caf\xC3\xA9 \xFF\xFE")},
+		{"truncated sequence", UTF8, []byte("ok \xE2\x82")},
+		{"nul bytes", UTF8, []byte("a\x00b\x00\x00")},
+		{"escape range rune", UTF8, []byte("\xF4\x8F\xBC\x80")},
+		{"utf-8 bom", UTF8BOM, []byte("\xEF\xBB\xBFx\x80y")},
+		{"unpaired surrogate", UTF16LEBOM, []byte("\xFF\xFEa\x00\x00\xD8b\x00")},
+		{"odd byte", UTF16BEBOM, []byte("\xFE\xFF\x00a\x00")},
+		{"escape range pair", UTF16LEBOM, []byte("\xFF\xFE\xFF\xDB\x00\xDF")},
+	}
+
+	for _, tt := range tests {
+		text, err := decodeText(tt.data, tt.enc)
+		if err != nil {
+			t.Errorf("%s: decode failed: %v", tt.name, err)
+			continue
+		}
+		data, err := encodeText(text, tt.enc)
+		if err != nil {
+			t.Errorf("%s: encode failed: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: round trip gave %q, want %q", tt.name, data, tt.data)
+		}
+	}
+}
+
+func TestRawBytes_DetectedEncodingRoundTrips(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Encoding
+	}{
+		{"nul-interleaved ascii", []byte("a\x00b\x00c\x00d\x00"), UTF16LE},
+		{"utf-16le no bom", []byte("h\x00i\x00\n\x00"), UTF16LE},
+		{"utf-16be no bom", []byte("\x00h\x00i\x00\n"), UTF16BE},
+		{"unpaired surrogate", []byte("a\x00b\x00c\x00d\x00e\x00f\x00\x00\xD8g\x00h\x00i\x00j\x00k\x00"), UTF8},
+		{"all nul", []byte("\x00\x00\x00\x00"), UTF8},
+	}
+
+	for _, tt := range tests {
+		enc := detectEncoding(tt.data)
+		if enc != tt.expected {
+			t.Errorf("%s: detectEncoding = %v, want %v", tt.name, enc, tt.expected)
+		}
+		text, err := decodeText(tt.data, enc)
+		if err != nil {
+			t.Errorf("%s: decode failed: %v", tt.name, err)
+			continue
+		}
+		data, err := encodeText(text, enc)
+		if err != nil {
+			t.Errorf("%s: encode failed: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: round trip gave %q, want %q", tt.name, data, tt.data)
+		}
+	}
+}
+
+func TestDecodeUTF8Raw_EscapesInvalidBytes(t *testing.T) {
+	runes := []rune(decodeUTF8Raw([]byte("a\xFFb")))
+	if len(runes) != 3 || runes[0] != 'a' || runes[2] != 'b' {
+		t.Fatalf("Expected three runes, got %q", runes)
+	}
+	if b, ok := rawByteOf(runes[1]); !ok || b != 0xFF {
+		t.Errorf("Expected the bad byte to be escaped, got %U", runes[1])
+	}
+}
+
+func TestEscapedCluster(t *testing.T) {
+	tests := []struct {
+		r        rune
+		expected string
+		ok       bool
+	}{
+		{rawByteRune(0xAB), "<0xAB>", true},
+		{0, "<0x00>", true},
+		{0x1B, "<0x1B>", true},
+		{0x7F, "<0x7F>", true},
+		{'\t', "", false},
+		{'a', "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := escapedCluster([]rune{tt.r})
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("escapedCluster(%U) = %q, %v, want %q, %v", tt.r, got, ok, tt.expected, tt.ok)
+		}
+		if ok && graphemeWidth([]rune{tt.r}) != len(tt.expected) {
+			t.Errorf("Expected %U to be %d columns wide, got %d", tt.r, len(tt.expected), graphemeWidth([]rune{tt.r}))
+		}
+	}
+}
+
+func TestEditor_BinaryFile_SavesUntouchedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	original := []byte("header\n\x00\x01\xFF\xFE\r\x89PNG\r\n\x1A\ntrailer")
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("NewEditorFromFile failed: %v", err)
+	}
+	if editor.GetFileManager().GetEncoding() != UTF8 {
+		t.Errorf("Expected binary data to open as UTF-8, got %v", editor.GetFileManager().GetEncoding())
+	}
+
+	editor.SetCursorPosition(0)
+	editor.InsertAtCursor("new ")
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved file: %v", err)
+	}
+	expected := append([]byte("new "), original...)
+	if !bytes.Equal(saved, expected) {
+		t.Errorf("Expected untouched bytes to survive, got %q", saved)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// replacement is a match and the text it will be replaced with.
+type replacement struct {
+	start, end int
+	text       string
+}
+
+// replacementFor returns the text that replaces the match [start, end). In
+// regexp mode $1 and ${name} in template expand to the match's groups, as in
+// regexp.Expand; otherwise template is used as it is.
+func (s *Search) replacementFor(pt *PieceTable, start, end int, template string) string {
+	if !s.options.Regexp {
+		return template
+	}
+
+	// Match again within the surrounding lines so anchors see the same
+	// context they did when searching.
+	from := pt.lineStart(pt.lineBreaksBefore(start))
+	to := pt.lineStart(pt.lineBreaksBefore(end) + 1)
+	text := pt.Substring(from, to)
+	byteStart := len(pt.Substring(from, start))
+
+	for _, loc := range s.re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == byteStart {
+			return string(s.re.ExpandString(nil, template, text, loc))
+		}
+	}
+	if loc := s.re.FindStringSubmatchIndex(text[byteStart:]); loc != nil {
+		return string(s.re.ExpandString(nil, template, text[byteStart:], loc))
+	}
+	return template
+}
+
+// replaceMatches applies replacements, which must not overlap, as a single
+// undo step. They are applied from the end of the buffer back, so earlier
+// offsets stay valid.
+func (e *Editor) replaceMatches(replacements []replacement) {
+	if len(replacements) == 0 {
+		return
+	}
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start > replacements[j].start
+	})
+
+	e.ClearSelection()
+	e.BeginGroup()
+	for _, r := range replacements {
+		e.executeCommand(NewReplaceCommand(e.buffer, e.cursor, r.start, r.end-r.start, r.text))
+	}
+	e.EndGroup()
+}
+
+// ReplaceAll replaces every match of search in the buffer as one undo step
+// and returns how many were replaced.
+func (e *Editor) ReplaceAll(search *Search, template string) int {
+	if !e.editable() {
+		return 0
+	}
+
+	var replacements []replacement
+	for offset := 0; ; {
+		start, end, ok := search.Next(e.buffer, offset)
+		if !ok {
+			break
+		}
+		replacements = append(replacements, replacement{start, end, search.replacementFor(e.buffer, start, end, template)})
+		offset = end
+	}
+	e.replaceMatches(replacements)
+	return len(replacements)
+}
+
+// Replacer steps through the matches of a search from the cursor to the end
+// of the buffer and then from the start back to the cursor, so each match is
+// offered once. Each replacement made with Replace is its own undo step.
+type Replacer struct {
+	editor   *Editor
+	search   *Search
+	template string
+
+	start, end int
+	found      bool
+	wrapped    bool
+	stop       int
+	count      int
+}
+
+// NewReplacer starts replacing matches of search with template, moving the
+// cursor to the first match.
+func (e *Editor) NewReplacer(search *Search, template string) *Replacer {
+	r := &Replacer{
+		editor:   e,
+		search:   search,
+		template: template,
+		stop:     e.cursor.GetPosition(),
+	}
+	if !e.editable() {
+		return r
+	}
+	r.advance(r.stop)
+	return r
+}
+
+// Match returns the match being offered, if there is one left.
+func (r *Replacer) Match() (start, end int, ok bool) {
+	return r.start, r.end, r.found
+}
+
+// Count returns how many matches have been replaced.
+func (r *Replacer) Count() int {
+	return r.count
+}
+
+// Replace replaces the current match and moves to the next one.
+func (r *Replacer) Replace() {
+	if !r.found {
+		return
+	}
+	text := r.search.replacementFor(r.editor.buffer, r.start, r.end, r.template)
+	r.editor.replaceMatches([]replacement{{r.start, r.end, text}})
+	r.count++
+
+	next := r.start + utf8.RuneCountInString(text)
+	if r.wrapped {
+		r.stop += next - r.end
+	}
+	r.advance(next)
+}
+
+// Skip leaves the current match and moves to the next one.
+func (r *Replacer) Skip() {
+	if r.found {
+		r.advance(r.end)
+	}
+}
+
+// ReplaceAll replaces the current match and every one after it as a single
+// undo step.
+func (r *Replacer) ReplaceAll() {
+	var replacements []replacement
+	for r.found {
+		text := r.search.replacementFor(r.editor.buffer, r.start, r.end, r.template)
+		replacements = append(replacements, replacement{r.start, r.end, text})
+		r.advance(r.end)
+	}
+	r.editor.replaceMatches(replacements)
+	r.count += len(replacements)
+}
+
+// advance finds the next match at or after offset, wrapping once to the
+// start of the buffer and ending at the position the replacer started from.
+func (r *Replacer) advance(offset int) {
+	buffer := r.editor.buffer
+	for {
+		start, end, ok := r.search.Next(buffer, offset)
+		if ok && (!r.wrapped || end <= r.stop) {
+			r.start, r.end, r.found = start, end, true
+			r.editor.SetCursorPosition(start)
+			return
+		}
+		if r.wrapped {
+			r.found = false
+			return
+		}
+		r.wrapped = true
+		offset = 0
+	}
+}
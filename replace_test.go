@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func TestEditor_ReplaceAll_IsOneUndoStep(t *testing.T) {
+	editor := NewEditor("cat hat cat bat cat")
+	search, _ := NewSearch("cat", SearchOptions{})
+
+	if n := editor.ReplaceAll(search, "dog"); n != 3 {
+		t.Errorf("Expected 3 replacements, got %d", n)
+	}
+	if editor.GetText() != "dog hat dog bat dog" {
+		t.Errorf("Expected all matches replaced, got %q", editor.GetText())
+	}
+
+	editor.Undo()
+	if editor.GetText() != "cat hat cat bat cat" {
+		t.Errorf("Expected one undo to revert every replacement, got %q", editor.GetText())
+	}
+	editor.Redo()
+	if editor.GetText() != "dog hat dog bat dog" {
+		t.Errorf("Expected redo to reapply them, got %q", editor.GetText())
+	}
+}
+
+func TestEditor_ReplaceAll_ExpandsGroups(t *testing.T) {
+	editor := NewEditor("key=value\nname=été\n")
+	search, err := NewSearch(`^(?P<key>\pL+)=(\pL+)$`, SearchOptions{Regexp: true})
+	if err != nil {
+		t.Fatalf("NewSearch failed: %v", err)
+	}
+
+	editor.ReplaceAll(search, "$2: ${key}")
+	if editor.GetText() != "value: key\nété: name\n" {
+		t.Errorf("Expected groups to be substituted, got %q", editor.GetText())
+	}
+}
+
+func TestEditor_ReplaceAll_LiteralKeepsDollar(t *testing.T) {
+	editor := NewEditor("price")
+	search, _ := NewSearch("price", SearchOptions{})
+
+	editor.ReplaceAll(search, "$1")
+	if editor.GetText() != "$1" {
+		t.Errorf("Expected a literal replacement, got %q", editor.GetText())
+	}
+}
+
+func TestReplacer_ConfirmEachMatchAndWrap(t *testing.T) {
+	editor := NewEditor("a1 a2 a3 a4")
+	editor.SetCursorPosition(6)
+	search, _ := NewSearch("a", SearchOptions{})
+	replacer := editor.NewReplacer(search, "bb")
+
+	// Starts at the cursor, wraps around and stops where it started.
+	var offered []int
+	for {
+		start, _, ok := replacer.Match()
+		if !ok {
+			break
+		}
+		offered = append(offered, start)
+		if len(offered)%2 == 1 {
+			replacer.Replace()
+		} else {
+			replacer.Skip()
+		}
+	}
+
+	if editor.GetText() != "bb1 a2 bb3 a4" {
+		t.Errorf("Expected alternate matches replaced, got %q", editor.GetText())
+	}
+	if len(offered) != 4 || replacer.Count() != 2 {
+		t.Errorf("Expected 4 matches offered and 2 replaced, got %v and %d", offered, replacer.Count())
+	}
+
+	editor.Undo()
+	if editor.GetText() != "a1 a2 bb3 a4" {
+		t.Errorf("Expected each confirmed replacement to undo on its own, got %q", editor.GetText())
+	}
+}
+
+func TestReplacer_ReplaceAllRemaining(t *testing.T) {
+	editor := NewEditor("x x x x")
+	search, _ := NewSearch("x", SearchOptions{})
+	replacer := editor.NewReplacer(search, "yy")
+
+	replacer.Skip()
+	replacer.ReplaceAll()
+	if _, _, ok := replacer.Match(); ok {
+		t.Error("Expected no matches left")
+	}
+	if editor.GetText() != "x yy yy yy" || replacer.Count() != 3 {
+		t.Errorf("Expected the rest replaced, got %q (%d)", editor.GetText(), replacer.Count())
+	}
+
+	editor.Undo()
+	if editor.GetText() != "x x x x" {
+		t.Errorf("Expected one undo for replace-all, got %q", editor.GetText())
+	}
+}
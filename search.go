@@ -0,0 +1,225 @@
+package main
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchWindow is roughly how many runes of the buffer are searched at once.
+// Windows are widened to whole lines, so ^ and $ behave, but a match can not
+// span two windows.
+const searchWindow = 64 << 10
+
+// SearchOptions selects how a search pattern is matched. They combine, so a
+// regular expression can also be case-insensitive or whole-word.
+type SearchOptions struct {
+	IgnoreCase bool
+	WholeWord  bool
+	Regexp     bool
+}
+
+// Search is a compiled search pattern. It reads the PieceTable a window at a
+// time rather than copying the whole text, so it is cheap to run on every
+// keystroke.
+type Search struct {
+	pattern string
+	options SearchOptions
+	re      *regexp.Regexp
+}
+
+// NewSearch compiles pattern. Without the Regexp option it is matched
+// literally. With it, ^ and $ match at every line.
+func NewSearch(pattern string, options SearchOptions) (*Search, error) {
+	expr := pattern
+	if !options.Regexp {
+		expr = regexp.QuoteMeta(pattern)
+	}
+	flags := "(?m)"
+	if options.IgnoreCase {
+		flags = "(?mi)"
+	}
+
+	re, err := regexp.Compile(flags + expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Search{pattern: pattern, options: options, re: re}, nil
+}
+
+func (s *Search) Pattern() string {
+	return s.pattern
+}
+
+func (s *Search) Options() SearchOptions {
+	return s.options
+}
+
+// Next returns the first match starting at or after offset.
+func (s *Search) Next(pt *PieceTable, offset int) (start, end int, ok bool) {
+	from := pt.lineStart(pt.lineBreaksBefore(offset))
+	for from < pt.Length() {
+		to := searchWindowEnd(pt, from)
+		for _, m := range s.Matches(pt, from, to) {
+			if m[0] >= offset {
+				return m[0], m[1], true
+			}
+		}
+		from = to
+	}
+	return 0, 0, false
+}
+
+// Prev returns the last match starting before offset.
+func (s *Search) Prev(pt *PieceTable, offset int) (start, end int, ok bool) {
+	to := pt.lineStart(pt.lineBreaksBefore(offset) + 1)
+	for to > 0 {
+		from := searchWindowStart(pt, to)
+		matches := s.Matches(pt, from, to)
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i][0] < offset {
+				return matches[i][0], matches[i][1], true
+			}
+		}
+		to = from
+	}
+	return 0, 0, false
+}
+
+// Matches returns the [start, end) offsets of the matches within [from, to),
+// which should begin at a line start. Empty matches are skipped.
+func (s *Search) Matches(pt *PieceTable, from, to int) [][2]int {
+	text := pt.Substring(from, to)
+
+	var matches [][2]int
+	bytePos, runePos := 0, from
+	for _, loc := range s.re.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		runePos += utf8.RuneCountInString(text[bytePos:loc[0]])
+		start := runePos
+		runePos += utf8.RuneCountInString(text[loc[0]:loc[1]])
+		bytePos = loc[1]
+
+		if s.options.WholeWord && !isWholeWord(pt, text, loc, start, runePos) {
+			continue
+		}
+		matches = append(matches, [2]int{start, runePos})
+	}
+	return matches
+}
+
+// isWholeWord reports whether the match at loc in text, which is [start, end)
+// in the buffer, is not part of a longer word. Only ends of the match that
+// are word characters need a boundary.
+func isWholeWord(pt *PieceTable, text string, loc []int, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[loc[0]:])
+	if isWordRune(first) {
+		var before rune
+		if loc[0] > 0 {
+			before, _ = utf8.DecodeLastRuneInString(text[:loc[0]])
+		} else {
+			before, _ = pt.RuneIterator(start).Prev()
+		}
+		if isWordRune(before) {
+			return false
+		}
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(text[:loc[1]])
+	if isWordRune(last) {
+		var after rune
+		if loc[1] < len(text) {
+			after, _ = utf8.DecodeRuneInString(text[loc[1]:])
+		} else {
+			after, _ = pt.RuneIterator(end).Next()
+		}
+		if isWordRune(after) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// searchWindowEnd returns where the window starting at from ends: at the line
+// break after searchWindow runes, unless that line is very long.
+func searchWindowEnd(pt *PieceTable, from int) int {
+	end := min(from+searchWindow, pt.Length())
+	line := pt.lineBreaksBefore(end)
+	if end == pt.Length() || pt.lineStart(line) == end {
+		return end
+	}
+	if next := pt.lineStart(line + 1); next-end <= searchWindow {
+		return next
+	}
+	return end
+}
+
+// searchWindowStart returns where the window ending at to starts, mirroring
+// searchWindowEnd.
+func searchWindowStart(pt *PieceTable, to int) int {
+	start := max(to-searchWindow, 0)
+	if lineStart := pt.lineStart(pt.lineBreaksBefore(start)); start-lineStart <= searchWindow {
+		return lineStart
+	}
+	return start
+}
+
+// SetSearch sets the pattern that is highlighted and that FindNext and
+// FindPrev look for. nil clears it.
+func (e *Editor) SetSearch(search *Search) {
+	e.search = search
+}
+
+func (e *Editor) GetSearch() *Search {
+	return e.search
+}
+
+// FindFrom moves the cursor to the first match at or after offset, wrapping
+// around to the start of the buffer. It reports whether there was a match
+// and whether the search wrapped to find it.
+func (e *Editor) FindFrom(offset int) (found, wrapped bool) {
+	if e.search == nil {
+		return false, false
+	}
+	start, _, ok := e.search.Next(e.buffer, offset)
+	if !ok && offset > 0 {
+		start, _, ok = e.search.Next(e.buffer, 0)
+		wrapped = ok
+	}
+	if ok {
+		e.ClearSelection()
+		e.SetCursorPosition(start)
+		_, e.desiredCol = e.buffer.GetLineColumn(start)
+	}
+	return ok, wrapped
+}
+
+// FindNext moves to the match after the cursor.
+func (e *Editor) FindNext() (found, wrapped bool) {
+	return e.FindFrom(e.cursor.GetPosition() + 1)
+}
+
+// FindPrev moves to the match before the cursor, wrapping around to the end
+// of the buffer.
+func (e *Editor) FindPrev() (found, wrapped bool) {
+	if e.search == nil {
+		return false, false
+	}
+	start, _, ok := e.search.Prev(e.buffer, e.cursor.GetPosition())
+	if !ok {
+		start, _, ok = e.search.Prev(e.buffer, e.buffer.Length()+1)
+		wrapped = ok
+	}
+	if ok {
+		e.ClearSelection()
+		e.SetCursorPosition(start)
+		_, e.desiredCol = e.buffer.GetLineColumn(start)
+	}
+	return ok, wrapped
+}
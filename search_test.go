@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newSearchTable(t *testing.T, text string) *PieceTable {
+	t.Helper()
+	// Build the text from several pieces so matches cross piece boundaries.
+	pt := NewPieceTable("")
+	for _, part := range strings.SplitAfter(text, " ") {
+		pt.Insert(pt.Length(), part)
+	}
+	return pt
+}
+
+func TestSearch_Matches_Modes(t *testing.T) {
+	text := "Foo food foo_bar\nfoo, FOO été"
+	tests := []struct {
+		name     string
+		pattern  string
+		options  SearchOptions
+		expected [][2]int
+	}{
+		{"literal", "foo", SearchOptions{}, [][2]int{{4, 7}, {9, 12}, {17, 20}}},
+		{"ignore case", "foo", SearchOptions{IgnoreCase: true}, [][2]int{{0, 3}, {4, 7}, {9, 12}, {17, 20}, {22, 25}}},
+		{"whole word", "foo", SearchOptions{IgnoreCase: true, WholeWord: true}, [][2]int{{0, 3}, {17, 20}, {22, 25}}},
+		{"regexp", `^fo+`, SearchOptions{Regexp: true}, [][2]int{{17, 20}}},
+		{"literal metacharacters", "o, F", SearchOptions{}, [][2]int{{19, 23}}},
+		{"unicode offsets", "été", SearchOptions{}, [][2]int{{26, 29}}},
+		{"empty matches skipped", `x*`, SearchOptions{Regexp: true}, nil},
+	}
+
+	pt := newSearchTable(t, text)
+	for _, tt := range tests {
+		search, err := NewSearch(tt.pattern, tt.options)
+		if err != nil {
+			t.Fatalf("%s: NewSearch failed: %v", tt.name, err)
+		}
+		if got := search.Matches(pt, 0, pt.Length()); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestSearch_NextAndPrev(t *testing.T) {
+	pt := newSearchTable(t, "a x a x a")
+	search, _ := NewSearch("a", SearchOptions{})
+
+	if start, _, ok := search.Next(pt, 1); !ok || start != 4 {
+		t.Errorf("Expected next match at 4, got %d %v", start, ok)
+	}
+	if _, _, ok := search.Next(pt, 9); ok {
+		t.Error("Expected no match after the last one")
+	}
+	if start, _, ok := search.Prev(pt, 8); !ok || start != 4 {
+		t.Errorf("Expected previous match at 4, got %d %v", start, ok)
+	}
+	if _, _, ok := search.Prev(pt, 0); ok {
+		t.Error("Expected no match before the first one")
+	}
+}
+
+func TestSearch_AcrossWindows(t *testing.T) {
+	line := strings.Repeat("x", 1000) + "\n"
+	text := strings.Repeat(line, 3*searchWindow/len(line)) + "needle\n" + strings.Repeat(line, 100)
+	pt := NewPieceTable(text)
+	search, _ := NewSearch("^needle$", SearchOptions{Regexp: true})
+
+	expected := strings.Index(text, "needle")
+	if start, end, ok := search.Next(pt, 0); !ok || start != expected || end != expected+6 {
+		t.Errorf("Expected match at %d, got %d-%d %v", expected, start, end, ok)
+	}
+	if start, _, ok := search.Prev(pt, pt.Length()); !ok || start != expected {
+		t.Errorf("Expected previous match at %d, got %d %v", expected, start, ok)
+	}
+}
+
+func TestNewSearch_InvalidRegexp(t *testing.T) {
+	if _, err := NewSearch("(", SearchOptions{Regexp: true}); err == nil {
+		t.Error("Expected an error for an invalid regexp")
+	}
+	if _, err := NewSearch("(", SearchOptions{}); err != nil {
+		t.Errorf("Expected a literal ( to compile, got %v", err)
+	}
+}
+
+func TestEditor_FindNextAndPrev_Wrap(t *testing.T) {
+	editor := NewEditor("one two one two")
+	search, _ := NewSearch("two", SearchOptions{})
+	editor.SetSearch(search)
+
+	if found, wrapped := editor.FindFrom(0); !found || wrapped || editor.GetCursorPosition() != 4 {
+		t.Errorf("Expected first match at 4, got %d (%v, %v)", editor.GetCursorPosition(), found, wrapped)
+	}
+	editor.FindNext()
+	if editor.GetCursorPosition() != 12 {
+		t.Errorf("Expected next match at 12, got %d", editor.GetCursorPosition())
+	}
+	if found, wrapped := editor.FindNext(); !found || !wrapped || editor.GetCursorPosition() != 4 {
+		t.Errorf("Expected to wrap to 4, got %d (%v, %v)", editor.GetCursorPosition(), found, wrapped)
+	}
+	if found, wrapped := editor.FindPrev(); !found || !wrapped || editor.GetCursorPosition() != 12 {
+		t.Errorf("Expected to wrap back to 12, got %d (%v, %v)", editor.GetCursorPosition(), found, wrapped)
+	}
+
+	editor.SetSearch(nil)
+	if found, _ := editor.FindNext(); found {
+		t.Error("Expected no match without a search")
+	}
+}
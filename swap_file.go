@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// swapInterval is how often unsaved edits are journaled to the swap file.
+const swapInterval = 4 * time.Second
+
+// swapEdit is one buffer change, as reported to a ChangeListener.
+type swapEdit struct {
+	Offset   int    `json:"offset"`
+	Inserted string `json:"inserted,omitempty"`
+	Deleted  int    `json:"deleted,omitempty"`
+}
+
+// swapHeader is the first line of a swap file. The edits of the entries that
+// follow replay on top of the file content whose hash is BaseHash, which is
+// the content last loaded or saved.
+type swapHeader struct {
+	PID      int    `json:"pid"`
+	Hostname string `json:"hostname"`
+	BaseHash string `json:"baseHash"`
+}
+
+// swapEntry is one line of a swap file after the header, holding the edits
+// made since the line before it. Each sync appends one, so the file is never
+// rewritten while editing.
+type swapEntry struct {
+	Modified time.Time  `json:"modified"`
+	Cursor   int        `json:"cursor"`
+	Edits    []swapEdit `json:"edits"`
+}
+
+// SwapFile journals the edits made since the last save to a hidden file next
+// to the document, so they survive a crash.
+type SwapFile struct {
+	path     string
+	baseHash string
+	edits    []swapEdit
+	synced   int
+	disabled bool
+}
+
+func swapPathFor(filePath string) string {
+	dir, base := filepath.Split(filePath)
+	return filepath.Join(dir, "."+base+".swp")
+}
+
+// NewSwapFile starts a journal for filePath on top of the text whose hash is
+// baseHash.
+func NewSwapFile(filePath, baseHash string) *SwapFile {
+	return &SwapFile{
+		path:     swapPathFor(filePath),
+		baseHash: baseHash,
+	}
+}
+
+// SetFilePath moves the journal to the swap file of another document, as
+// after Save As.
+func (s *SwapFile) SetFilePath(filePath string) {
+	s.path = swapPathFor(filePath)
+	s.disabled = false
+	s.synced = 0
+}
+
+// Record is a ChangeListener that appends an edit to the journal.
+func (s *SwapFile) Record(offset int, inserted string, deleted int) {
+	s.edits = append(s.edits, swapEdit{
+		Offset:   offset,
+		Inserted: inserted,
+		Deleted:  deleted,
+	})
+}
+
+// Sync appends the edits recorded since the last write to the swap file. The
+// first write of a journal, or one whose file has gone, writes every edit.
+func (s *SwapFile) Sync(cursor int) error {
+	if s.disabled || s.synced == len(s.edits) {
+		return nil
+	}
+
+	if s.synced > 0 {
+		err := s.appendEntry(cursor, s.edits[s.synced:])
+		if !errors.Is(err, os.ErrNotExist) {
+			if err == nil {
+				s.synced = len(s.edits)
+			}
+			return err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	header, err := json.Marshal(swapHeader{
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		BaseHash: s.baseHash,
+	})
+	if err != nil {
+		return err
+	}
+	entry, err := s.entry(cursor, s.edits)
+	if err != nil {
+		return err
+	}
+
+	data := append(append(header, '\n'), entry...)
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.synced = len(s.edits)
+	return nil
+}
+
+// appendEntry adds a line with edits to the end of the existing swap file.
+func (s *SwapFile) appendEntry(cursor int, edits []swapEdit) error {
+	entry, err := s.entry(cursor, edits)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(entry); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// entry encodes one swap file line, ending in a newline so a line cut short
+// by a crash can be told apart.
+func (s *SwapFile) entry(cursor int, edits []swapEdit) ([]byte, error) {
+	data, err := json.Marshal(swapEntry{
+		Modified: time.Now(),
+		Cursor:   cursor,
+		Edits:    edits,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Reset starts a new journal on top of freshly saved text with the given
+// hash and removes the swap file, since there is nothing left to recover.
+func (s *SwapFile) Reset(baseHash string) error {
+	s.baseHash = baseHash
+	s.edits = nil
+	s.synced = 0
+	return s.Remove()
+}
+
+// Remove deletes the swap file unless another instance owns it.
+func (s *SwapFile) Remove() error {
+	if s.disabled {
+		return nil
+	}
+	err := os.Remove(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SwapRecovery describes a swap file left behind for a document.
+type SwapRecovery struct {
+	Path         string
+	Modified     time.Time
+	PID          int
+	OwnerRunning bool
+	Cursor       int
+	Err          error
+	edits        []swapEdit
+}
+
+// findSwapRecovery looks for a leftover swap file for the text with the given
+// hash. Err is set when the journal cannot be applied, for example because
+// the file changed on disk after the swap was written.
+func findSwapRecovery(filePath, hash string) *SwapRecovery {
+	path := swapPathFor(filePath)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	recovery := &SwapRecovery{Path: path}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	line, err := reader.ReadBytes('\n')
+	var header swapHeader
+	if err == nil {
+		err = json.Unmarshal(line, &header)
+	}
+	if err != nil {
+		recovery.Err = fmt.Errorf("unreadable swap file: %w", err)
+		return recovery
+	}
+
+	var edits []swapEdit
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A last line without its newline was cut short by a crash
+			// and holds nothing that was finished.
+			break
+		}
+		var entry swapEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			recovery.Err = fmt.Errorf("unreadable swap file: %w", err)
+			return recovery
+		}
+		edits = append(edits, entry.Edits...)
+		recovery.Modified = entry.Modified
+		recovery.Cursor = entry.Cursor
+	}
+
+	hostname, _ := os.Hostname()
+	recovery.PID = header.PID
+	recovery.OwnerRunning = header.PID != os.Getpid() && header.Hostname == hostname && processRunning(header.PID)
+
+	if header.BaseHash != hash {
+		recovery.Err = errors.New("file changed on disk after the swap file was written")
+		return recovery
+	}
+
+	recovery.edits = edits
+	return recovery
+}
+
+// Prompt returns the question shown when the swap file is found.
+func (r *SwapRecovery) Prompt() string {
+	owner := ""
+	if r.OwnerRunning {
+		owner = fmt.Sprintf(" in use by process %d", r.PID)
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("Swap file%s can't be recovered (%v). (x) discard, (q)uit: ", owner, r.Err)
+	}
+	return fmt.Sprintf("Swap file%s from %s. (r)ecover, (d)iff, (x) discard, (q)uit: ", owner, r.Modified.Format("2006-01-02 15:04"))
+}
+
+// summarizeDiff describes where two texts differ by line, after trimming the
+// lines they share at the start and end. Lines are compared one at a time, so
+// large buffers are never built into strings.
+func summarizeDiff(current, recovered *PieceTable) string {
+	a, b := current.GetLineCount(), recovered.GetLineCount()
+
+	prefix := 0
+	for ai, bi := current.LineIteratorAt(0), recovered.LineIteratorAt(0); prefix < a && prefix < b; prefix++ {
+		lineA, _ := ai.Next()
+		lineB, _ := bi.Next()
+		if lineA != lineB {
+			break
+		}
+	}
+	if prefix == a && prefix == b {
+		return "Swap file matches the file on disk"
+	}
+
+	suffix := 0
+	for ai, bi := current.LineIteratorAt(a), recovered.LineIteratorAt(b); suffix < a-prefix && suffix < b-prefix; suffix++ {
+		lineA, _ := ai.Prev()
+		lineB, _ := bi.Prev()
+		if lineA != lineB {
+			break
+		}
+	}
+
+	return fmt.Sprintf("Swap differs from line %d: %d lines on disk, %d lines in swap", prefix+1, a-prefix-suffix, b-prefix-suffix)
+}
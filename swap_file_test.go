@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openSwapTestFile(t *testing.T, content string) (*Editor, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	return editor, path
+}
+
+func TestSwapFile_SyncAndReopen_RecoversEdits(t *testing.T) {
+	editor, path := openSwapTestFile(t, "Hello\nWorld")
+	editor.SetCursorPosition(5)
+	editor.InsertAtCursor(", there")
+	editor.SetCursorPosition(0)
+	editor.Delete()
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+
+	recovery := reopened.PendingSwapRecovery()
+	if recovery == nil {
+		t.Fatal("Expected a swap file to be found")
+	}
+	if recovery.Err != nil {
+		t.Fatalf("Expected recoverable swap, got %v", recovery.Err)
+	}
+	if recovery.OwnerRunning {
+		t.Error("Expected swap written by this process to not count as another instance")
+	}
+
+	if err := reopened.RecoverSwap(); err != nil {
+		t.Fatalf("RecoverSwap failed: %v", err)
+	}
+	if reopened.GetText() != "ello, there\nWorld" {
+		t.Errorf("Expected recovered text, got %q", reopened.GetText())
+	}
+	if !reopened.GetFileManager().IsDirty() {
+		t.Error("Expected recovered buffer to be dirty")
+	}
+	if reopened.PendingSwapRecovery() != nil {
+		t.Error("Expected recovery to be cleared")
+	}
+
+	reopened.Undo()
+	if reopened.GetText() != "Hello\nWorld" {
+		t.Errorf("Expected recovery to undo in one step, got %q", reopened.GetText())
+	}
+}
+
+func TestSwapFile_Sync_AppendsOnlyNewEdits(t *testing.T) {
+	editor, path := openSwapTestFile(t, "Hello")
+	editor.SetCursorPosition(5)
+	editor.InsertAtCursor(" there")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	first, _ := os.ReadFile(swapPathFor(path))
+
+	editor.InsertAtCursor("!")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	second, _ := os.ReadFile(swapPathFor(path))
+
+	added, ok := strings.CutPrefix(string(second), string(first))
+	if !ok || strings.Count(added, "\n") != 1 || strings.Contains(added, "there") {
+		t.Errorf("Expected one line with only the new edit appended, got %q", added)
+	}
+
+	// A crash while appending leaves a line without its newline, which
+	// recovery skips.
+	if err := os.WriteFile(swapPathFor(path), append(second, `{"edits":[{"off`...), 0644); err != nil {
+		t.Fatalf("Failed to write swap: %v", err)
+	}
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+	if err := reopened.RecoverSwap(); err != nil {
+		t.Fatalf("RecoverSwap failed: %v", err)
+	}
+	if reopened.GetText() != "Hello there!" {
+		t.Errorf("Expected both syncs recovered, got %q", reopened.GetText())
+	}
+}
+
+func TestSwapFile_Save_RemovesSwap(t *testing.T) {
+	editor, path := openSwapTestFile(t, "Hello")
+	editor.InsertAtCursor("Oh ")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	if _, err := os.Stat(swapPathFor(path)); err != nil {
+		t.Fatalf("Expected swap file to exist: %v", err)
+	}
+
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(swapPathFor(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected swap file to be removed after save, got %v", err)
+	}
+
+	// Edits after a save journal on top of the saved text.
+	editor.SetCursorPosition(editor.GetBuffer().Length())
+	editor.InsertAtCursor("!")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+	if err := reopened.RecoverSwap(); err != nil {
+		t.Fatalf("RecoverSwap failed: %v", err)
+	}
+	if reopened.GetText() != "Oh Hello!" {
+		t.Errorf("Expected swap to replay onto saved text, got %q", reopened.GetText())
+	}
+}
+
+func TestSwapFile_FileChangedOnDisk_CannotRecover(t *testing.T) {
+	editor, path := openSwapTestFile(t, "Hello")
+	editor.InsertAtCursor("x")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("Changed"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+	if reopened.PendingSwapRecovery() == nil || reopened.PendingSwapRecovery().Err == nil {
+		t.Fatal("Expected an unrecoverable swap")
+	}
+	if err := reopened.RecoverSwap(); err == nil {
+		t.Error("Expected RecoverSwap to fail")
+	}
+	if reopened.GetText() != "Changed" {
+		t.Errorf("Expected buffer to be untouched, got %q", reopened.GetText())
+	}
+}
+
+func TestSwapFile_DiscardSwap_RemovesFile(t *testing.T) {
+	editor, path := openSwapTestFile(t, "Hello")
+	editor.InsertAtCursor("x")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+	if err := reopened.DiscardSwap(); err != nil {
+		t.Fatalf("DiscardSwap failed: %v", err)
+	}
+	if _, err := os.Stat(swapPathFor(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected swap file to be removed, got %v", err)
+	}
+	if reopened.GetText() != "Hello" {
+		t.Errorf("Expected disk content, got %q", reopened.GetText())
+	}
+}
+
+func TestSwapFile_OwnedByRunningInstance_IsLeftAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// The test binary's parent is alive for as long as the test runs.
+	hostname, _ := os.Hostname()
+	header, _ := json.Marshal(swapHeader{
+		PID:      os.Getppid(),
+		Hostname: hostname,
+		BaseHash: contentHash("Hello"),
+	})
+	entry, _ := json.Marshal(swapEntry{
+		Edits: []swapEdit{{Offset: 5, Inserted: "!"}},
+	})
+	data := append(append(append(header, '\n'), entry...), '\n')
+	if err := os.WriteFile(swapPathFor(path), data, 0644); err != nil {
+		t.Fatalf("Failed to write swap: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	recovery := editor.PendingSwapRecovery()
+	if !processRunning(os.Getppid()) {
+		t.Skip("Cannot check other processes on this platform")
+	}
+	if recovery == nil || !recovery.OwnerRunning {
+		t.Fatalf("Expected swap to be owned by a running instance, got %+v", recovery)
+	}
+	if !strings.Contains(recovery.Prompt(), "in use") {
+		t.Errorf("Expected prompt to warn about the other instance, got %q", recovery.Prompt())
+	}
+
+	editor.InsertAtCursor("x")
+	if err := editor.SyncSwap(); err != nil {
+		t.Fatalf("SyncSwap failed: %v", err)
+	}
+	if err := editor.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	saved, err := os.ReadFile(swapPathFor(path))
+	if err != nil || string(saved) != string(data) {
+		t.Errorf("Expected the other instance's swap to be untouched, got %q (%v)", saved, err)
+	}
+}
+
+func TestSummarizeDiff(t *testing.T) {
+	tests := []struct {
+		current, recovered, expected string
+	}{
+		{"a\nb\nc", "a\nb\nc", "Swap file matches the file on disk"},
+		{"a\nb\nc", "a\nB\nc", "Swap differs from line 2: 1 lines on disk, 1 lines in swap"},
+		{"a\nc", "a\nb1\nb2\nc", "Swap differs from line 2: 0 lines on disk, 2 lines in swap"},
+	}
+
+	for _, tt := range tests {
+		if got := summarizeDiff(NewPieceTable(tt.current), NewPieceTable(tt.recovered)); got != tt.expected {
+			t.Errorf("summarizeDiff(%q, %q) = %q, want %q", tt.current, tt.recovered, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// reopenTerminal has nothing to do here: the console is read directly rather
+// than through standard input.
+func reopenTerminal() error {
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import "os"
+
+// reopenTerminal points standard input back at the controlling terminal once
+// piped input has been read. termbox reads keys from /dev/tty on its own, so
+// this only matters to anything else in the process that reads os.Stdin.
+func reopenTerminal() error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return err
+	}
+	os.Stdin = tty
+	return nil
+}
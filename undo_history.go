@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// undoHistoryDir returns the directory holding saved undo histories. Tests
+// point it somewhere temporary.
+var undoHistoryDir = func() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "texteditor", "undo"), nil
+}
+
+// undoHistoryFile is the on-disk form of an undo tree. ContentHash is the hash
+// of the buffer text at the current state, so a history is only restored onto
+// the exact text it was saved with.
+type undoHistoryFile struct {
+	ContentHash string            `json:"contentHash"`
+	Current     int               `json:"current"`
+	RootTime    time.Time         `json:"rootTime"`
+	States      []undoStateRecord `json:"states"`
+}
+
+type undoStateRecord struct {
+	Parent int          `json:"parent"`
+	Redo   int          `json:"redo"`
+	Time   time.Time    `json:"time"`
+	Edits  []editRecord `json:"edits"`
+}
+
+type editRecord struct {
+	Insert       bool   `json:"insert"`
+	Position     int    `json:"position"`
+	Text         string `json:"text"`
+	CursorBefore int    `json:"cursorBefore"`
+	CursorAfter  int    `json:"cursorAfter"`
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// undoHistoryPath returns the history file for a document, keyed by the hash
+// of its absolute path.
+func undoHistoryPath(filePath string) (string, error) {
+	dir, err := undoHistoryDir()
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, contentHash(absPath)+".json"), nil
+}
+
+func encodeEdits(cmd Command) ([]editRecord, error) {
+	switch c := cmd.(type) {
+	case *InsertCommand:
+		return []editRecord{{
+			Insert:       true,
+			Position:     c.position,
+			Text:         c.text,
+			CursorBefore: c.cursorBefore,
+			CursorAfter:  c.cursorAfter,
+		}}, nil
+	case *DeleteCommand:
+		return []editRecord{{
+			Position:     c.position,
+			Text:         c.deletedText,
+			CursorBefore: c.cursorBefore,
+			CursorAfter:  c.cursorAfter,
+		}}, nil
+	case *CompositeCommand:
+		var edits []editRecord
+		for _, child := range c.commands {
+			childEdits, err := encodeEdits(child)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, childEdits...)
+		}
+		return edits, nil
+	default:
+		return nil, fmt.Errorf("cannot save undo history for %T", cmd)
+	}
+}
+
+func (e *Editor) decodeEdits(edits []editRecord) Command {
+	commands := make([]Command, 0, len(edits))
+	for _, edit := range edits {
+		if edit.Insert {
+			commands = append(commands, &InsertCommand{
+				buffer:       e.buffer,
+				cursor:       e.cursor,
+				text:         edit.Text,
+				position:     edit.Position,
+				cursorBefore: edit.CursorBefore,
+				cursorAfter:  edit.CursorAfter,
+			})
+			continue
+		}
+
+		deleteCmd := NewDeleteCommand(e.buffer, e.cursor, edit.Position, len([]rune(edit.Text)))
+		deleteCmd.deletedText = edit.Text
+		deleteCmd.cursorBefore = edit.CursorBefore
+		deleteCmd.cursorAfter = edit.CursorAfter
+		commands = append(commands, deleteCmd)
+	}
+
+	if len(commands) == 1 {
+		return commands[0]
+	}
+	return NewCompositeCommand(commands...)
+}
+
+// saveUndoHistory writes the undo tree to the user's cache directory so it can
+// be restored when the same file content is opened again.
+func (e *Editor) saveUndoHistory() error {
+	if !e.fileManager.HasFile() {
+		return nil
+	}
+
+	history := undoHistoryFile{
+		ContentHash: e.buffer.Hash(),
+		Current:     e.history.CurrentSeq(),
+		RootTime:    e.history.root.time,
+	}
+	for _, node := range e.history.nodes[1:] {
+		edits, err := encodeEdits(node.command)
+		if err != nil {
+			return err
+		}
+		history.States = append(history.States, undoStateRecord{
+			Parent: node.parent.seq,
+			Redo:   node.redo,
+			Time:   node.time,
+			Edits:  edits,
+		})
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	path, err := undoHistoryPath(e.fileManager.GetFilePath())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// loadUndoHistory restores a saved undo tree if one exists for the file and
+// was saved with the text now in the buffer.
+func (e *Editor) loadUndoHistory() error {
+	path, err := undoHistoryPath(e.fileManager.GetFilePath())
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var history undoHistoryFile
+	if err := json.Unmarshal(data, &history); err != nil {
+		return err
+	}
+	if history.ContentHash != e.buffer.Hash() {
+		return nil
+	}
+	if history.Current < 0 || history.Current > len(history.States) {
+		return errors.New("undo history has an invalid current state")
+	}
+
+	tree := NewUndoTree(history.RootTime)
+	for i, state := range history.States {
+		if state.Parent < 0 || state.Parent > i {
+			return errors.New("undo history has an invalid parent state")
+		}
+		parent := tree.nodes[state.Parent]
+		node := &undoNode{
+			seq:     i + 1,
+			command: e.decodeEdits(state.Edits),
+			parent:  parent,
+			redo:    state.Redo,
+			time:    state.Time,
+		}
+		parent.children = append(parent.children, node)
+		tree.nodes = append(tree.nodes, node)
+	}
+	for _, node := range tree.nodes {
+		if node.redo < 0 || node.redo >= len(node.children) {
+			node.redo = max(len(node.children)-1, 0)
+		}
+	}
+
+	tree.current = tree.nodes[history.Current]
+	e.history = tree
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "texteditor-undo")
+	if err != nil {
+		panic(err)
+	}
+	undoHistoryDir = func() (string, error) {
+		return dir, nil
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestUndoHistory_SaveAndReopen_RestoresUndo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	editor.SetCursorPosition(5)
+	editor.InsertAtCursor(" World")
+	editor.SetCursorPosition(0)
+	editor.Delete()
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+
+	reopened.Undo()
+	if reopened.GetText() != "Hello World" {
+		t.Errorf("Expected 'Hello World', got '%s'", reopened.GetText())
+	}
+
+	reopened.Undo()
+	if reopened.GetText() != "Hello" {
+		t.Errorf("Expected 'Hello', got '%s'", reopened.GetText())
+	}
+
+	reopened.Redo()
+	reopened.Redo()
+	if reopened.GetText() != "ello World" {
+		t.Errorf("Expected 'ello World', got '%s'", reopened.GetText())
+	}
+}
+
+func TestUndoHistory_UndoPastSave_MarksDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dirty.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	editor.SetCursorPosition(5)
+	editor.TypeAtCursor("!")
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	// Typing on after a save starts a new undo step.
+	editor.TypeAtCursor("!")
+	editor.Undo()
+	if editor.GetText() != "Hello!" || editor.GetFileManager().IsDirty() {
+		t.Errorf("Expected the saved text to be clean, got %q, dirty %v", editor.GetText(), editor.GetFileManager().IsDirty())
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+	reopened.Undo()
+	if !reopened.GetFileManager().IsDirty() {
+		t.Error("Expected undoing past the save to mark the buffer dirty")
+	}
+	reopened.Redo()
+	if reopened.GetFileManager().IsDirty() {
+		t.Error("Expected redoing back to the saved state to mark the buffer clean")
+	}
+	reopened.GoToUndoState(0)
+	if !reopened.GetFileManager().IsDirty() {
+		t.Error("Expected going to an older state to mark the buffer dirty")
+	}
+}
+
+func TestUndoHistory_Reopen_KeepsBranchesAndGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "branches.txt")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	editor.SetCursorPosition(3)
+	editor.InsertAtCursor("d")
+	editor.Undo()
+	editor.SetCursorPosition(0)
+	editor.MoveCursorRightWithSelection()
+	editor.InsertAtCursor("X")
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+
+	if reopened.history.CurrentSeq() != 2 {
+		t.Errorf("Expected current state 2, got %d", reopened.history.CurrentSeq())
+	}
+
+	reopened.Undo()
+	if reopened.GetText() != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", reopened.GetText())
+	}
+
+	reopened.GoToUndoState(1)
+	if reopened.GetText() != "abcd" {
+		t.Errorf("Expected 'abcd', got '%s'", reopened.GetText())
+	}
+}
+
+func TestUndoHistory_ChangedFile_IgnoresHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changed.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	editor.SetCursorPosition(5)
+	editor.InsertAtCursor("!")
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("Changed elsewhere"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+
+	reopened, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file: %v", err)
+	}
+
+	if reopened.history.UndoCount() != 0 {
+		t.Errorf("Expected nothing to undo, got %d", reopened.history.UndoCount())
+	}
+}
+
+func TestUndoHistory_CorruptFile_OpensWithoutHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	historyPath, err := undoHistoryPath(path)
+	if err != nil {
+		t.Fatalf("Failed to get history path: %v", err)
+	}
+	if err := os.WriteFile(historyPath, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Expected file to open, got %v", err)
+	}
+
+	if editor.GetText() != "Hello" {
+		t.Errorf("Expected 'Hello', got '%s'", editor.GetText())
+	}
+}
+
+func TestUndoHistory_UnwritableCacheDoesNotFailSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("Hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// A file where the cache directory should be can't be written into,
+	// even by root.
+	blocked := filepath.Join(dir, "cache")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	saved := undoHistoryDir
+	undoHistoryDir = func() (string, error) {
+		return filepath.Join(blocked, "undo"), nil
+	}
+	defer func() { undoHistoryDir = saved }()
+
+	editor, err := NewEditorFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer editor.Close()
+	editor.SetCursorPosition(5)
+	editor.InsertAtCursor("!")
+
+	if err := editor.Save(); err != nil {
+		t.Fatalf("Expected the save to succeed, got %v", err)
+	}
+	if editor.UndoHistoryError() == nil {
+		t.Errorf("Expected the undo history error to be reported")
+	}
+	if content := readTestFile(t, path); content != "Hello!" {
+		t.Errorf("Expected 'Hello!' on disk, got '%s'", content)
+	}
+}
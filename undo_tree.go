@@ -0,0 +1,206 @@
+package main
+
+import "time"
+
+// undoNode is one buffer state in the undo tree. Applying command to the
+// parent's state produces this state; the root holds no command.
+type undoNode struct {
+	seq      int
+	command  Command
+	parent   *undoNode
+	children []*undoNode
+	redo     int
+	time     time.Time
+}
+
+// UndoTree records every edit as a node, so undoing and then editing starts a
+// new branch instead of discarding the undone edits. States are numbered in
+// the order they were created, like Vim's undo sequence numbers.
+type UndoTree struct {
+	root    *undoNode
+	current *undoNode
+	nodes   []*undoNode
+}
+
+// UndoState describes one node of the undo tree for listing.
+type UndoState struct {
+	Seq      int
+	Parent   int
+	Time     time.Time
+	Changes  int
+	Current  bool
+	Branches int
+}
+
+func NewUndoTree(at time.Time) *UndoTree {
+	root := &undoNode{time: at}
+	return &UndoTree{
+		root:    root,
+		current: root,
+		nodes:   []*undoNode{root},
+	}
+}
+
+// Push records an executed command as a new child of the current state and
+// makes it current.
+func (t *UndoTree) Push(cmd Command, at time.Time) {
+	node := &undoNode{
+		seq:     len(t.nodes),
+		command: cmd,
+		parent:  t.current,
+		time:    at,
+	}
+	t.current.children = append(t.current.children, node)
+	t.current.redo = len(t.current.children) - 1
+	t.current = node
+	t.nodes = append(t.nodes, node)
+}
+
+// Touch updates the time of the current state, for edits folded into it.
+func (t *UndoTree) Touch(at time.Time) {
+	t.current.time = at
+}
+
+// Undo moves to the parent state and returns the command to revert, or nil at
+// the root.
+func (t *UndoTree) Undo() Command {
+	if t.current.parent == nil {
+		return nil
+	}
+	node := t.current
+	t.current = node.parent
+	return node.command
+}
+
+// Redo moves down the most recently used branch and returns the command to
+// apply, or nil at a leaf.
+func (t *UndoTree) Redo() Command {
+	if len(t.current.children) == 0 {
+		return nil
+	}
+	t.current = t.current.children[t.current.redo]
+	return t.current.command
+}
+
+// UndoCount returns how many steps Undo can take from the current state.
+func (t *UndoTree) UndoCount() int {
+	count := 0
+	for n := t.current; n.parent != nil; n = n.parent {
+		count++
+	}
+	return count
+}
+
+// RedoCount returns how many steps Redo can take along the current branch.
+func (t *UndoTree) RedoCount() int {
+	count := 0
+	for n := t.current; len(n.children) > 0; n = n.children[n.redo] {
+		count++
+	}
+	return count
+}
+
+func (t *UndoTree) CurrentSeq() int {
+	return t.current.seq
+}
+
+func (t *UndoTree) CurrentTime() time.Time {
+	return t.current.time
+}
+
+func (t *UndoTree) LastSeq() int {
+	return len(t.nodes) - 1
+}
+
+// SwitchBranch changes which child Redo follows from the current state,
+// cycling through the branches by delta. It reports whether there was more
+// than one branch to choose from.
+func (t *UndoTree) SwitchBranch(delta int) bool {
+	count := len(t.current.children)
+	if count < 2 {
+		return false
+	}
+	t.current.redo = ((t.current.redo+delta)%count + count) % count
+	return true
+}
+
+// Path returns the commands to undo and then redo, in order, to move from the
+// current state to the state numbered seq. Redo choices along the way are
+// updated so plain Redo keeps following the visited branch.
+func (t *UndoTree) Path(seq int) (undo []Command, redo []Command, ok bool) {
+	if seq < 0 || seq >= len(t.nodes) {
+		return nil, nil, false
+	}
+	target := t.nodes[seq]
+
+	depth := func(n *undoNode) int {
+		d := 0
+		for ; n.parent != nil; n = n.parent {
+			d++
+		}
+		return d
+	}
+
+	from, to := t.current, target
+	var down []*undoNode
+	for fd, td := depth(from), depth(to); fd > td; fd-- {
+		undo = append(undo, from.command)
+		from = from.parent
+	}
+	for fd, td := depth(from), depth(to); td > fd; td-- {
+		down = append(down, to)
+		to = to.parent
+	}
+	for from != to {
+		undo = append(undo, from.command)
+		from = from.parent
+		down = append(down, to)
+		to = to.parent
+	}
+
+	for i := len(down) - 1; i >= 0; i-- {
+		node := down[i]
+		for j, child := range node.parent.children {
+			if child == node {
+				node.parent.redo = j
+			}
+		}
+		redo = append(redo, node.command)
+	}
+
+	t.current = target
+	return undo, redo, true
+}
+
+// SeqAt returns the newest state created at or before the given time, or the
+// root state when every edit is newer.
+func (t *UndoTree) SeqAt(at time.Time) int {
+	for i := len(t.nodes) - 1; i > 0; i-- {
+		if !t.nodes[i].time.After(at) {
+			return i
+		}
+	}
+	return 0
+}
+
+// States lists every state in creation order.
+func (t *UndoTree) States() []UndoState {
+	states := make([]UndoState, 0, len(t.nodes))
+	for _, n := range t.nodes {
+		state := UndoState{
+			Seq:      n.seq,
+			Parent:   -1,
+			Time:     n.time,
+			Current:  n == t.current,
+			Branches: len(n.children),
+		}
+		for p := n; p.parent != nil; p = p.parent {
+			state.Changes++
+		}
+		if n.parent != nil {
+			state.Parent = n.parent.seq
+		}
+		states = append(states, state)
+	}
+	return states
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type recordingCommand struct {
+	name string
+	log  *[]string
+}
+
+func (c *recordingCommand) Execute() {
+	*c.log = append(*c.log, "do "+c.name)
+}
+
+func (c *recordingCommand) Undo() {
+	*c.log = append(*c.log, "undo "+c.name)
+}
+
+func TestUndoTree_UndoRedo_FollowsLatestBranch(t *testing.T) {
+	log := []string{}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := NewUndoTree(start)
+
+	a := &recordingCommand{"a", &log}
+	b := &recordingCommand{"b", &log}
+	c := &recordingCommand{"c", &log}
+	tree.Push(a, start)
+	tree.Push(b, start)
+
+	if tree.Undo() != b {
+		t.Error("Expected undo to return b")
+	}
+
+	tree.Push(c, start)
+
+	if tree.RedoCount() != 0 {
+		t.Errorf("Expected redo count 0, got %d", tree.RedoCount())
+	}
+
+	if tree.Undo() != c {
+		t.Error("Expected undo to return c")
+	}
+
+	if tree.Redo() != c {
+		t.Error("Expected redo to follow the newest branch c")
+	}
+
+	if tree.UndoCount() != 2 {
+		t.Errorf("Expected undo count 2, got %d", tree.UndoCount())
+	}
+}
+
+func TestUndoTree_SwitchBranch_ChangesRedoTarget(t *testing.T) {
+	log := []string{}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := NewUndoTree(start)
+
+	b := &recordingCommand{"b", &log}
+	c := &recordingCommand{"c", &log}
+	tree.Push(b, start)
+	tree.Undo()
+	tree.Push(c, start)
+	tree.Undo()
+
+	if !tree.SwitchBranch(1) {
+		t.Fatal("Expected two branches to switch between")
+	}
+
+	if tree.Redo() != b {
+		t.Error("Expected redo to follow branch b after switching")
+	}
+
+	if tree.SwitchBranch(1) {
+		t.Error("Expected no branches to switch between at a leaf")
+	}
+}
+
+func TestUndoTree_Path_CrossesBranches(t *testing.T) {
+	log := []string{}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := NewUndoTree(start)
+
+	a := &recordingCommand{"a", &log}
+	b := &recordingCommand{"b", &log}
+	c := &recordingCommand{"c", &log}
+	d := &recordingCommand{"d", &log}
+	tree.Push(a, start)
+	tree.Push(b, start)
+	tree.Push(c, start)
+	tree.Undo()
+	tree.Undo()
+	tree.Push(d, start)
+
+	undo, redo, ok := tree.Path(3)
+	if !ok {
+		t.Fatal("Expected path to state 3")
+	}
+
+	if len(undo) != 1 || undo[0] != d {
+		t.Errorf("Expected to undo d, got %v", undo)
+	}
+
+	if len(redo) != 2 || redo[0] != b || redo[1] != c {
+		t.Errorf("Expected to redo b then c, got %v", redo)
+	}
+
+	if tree.CurrentSeq() != 3 {
+		t.Errorf("Expected current state 3, got %d", tree.CurrentSeq())
+	}
+
+	tree.Undo()
+	tree.Undo()
+	if tree.Redo() != b {
+		t.Error("Expected redo to follow the branch visited by Path")
+	}
+
+	if _, _, ok := tree.Path(10); ok {
+		t.Error("Expected no path to a missing state")
+	}
+}
+
+func TestUndoTree_SeqAt_FindsNewestStateAtTime(t *testing.T) {
+	log := []string{}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := NewUndoTree(start)
+
+	tree.Push(&recordingCommand{"a", &log}, start.Add(time.Minute))
+	tree.Push(&recordingCommand{"b", &log}, start.Add(5*time.Minute))
+	tree.Push(&recordingCommand{"c", &log}, start.Add(10*time.Minute))
+
+	if seq := tree.SeqAt(start.Add(6 * time.Minute)); seq != 2 {
+		t.Errorf("Expected state 2, got %d", seq)
+	}
+
+	if seq := tree.SeqAt(start); seq != 0 {
+		t.Errorf("Expected root state 0, got %d", seq)
+	}
+}
+
+func TestUndoTree_States_ListsEveryState(t *testing.T) {
+	log := []string{}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tree := NewUndoTree(start)
+
+	tree.Push(&recordingCommand{"a", &log}, start)
+	tree.Push(&recordingCommand{"b", &log}, start)
+	tree.Undo()
+	tree.Push(&recordingCommand{"c", &log}, start)
+
+	states := tree.States()
+	if len(states) != 4 {
+		t.Fatalf("Expected 4 states, got %d", len(states))
+	}
+
+	if states[1].Branches != 2 {
+		t.Errorf("Expected state 1 to have 2 branches, got %d", states[1].Branches)
+	}
+
+	if states[3].Parent != 1 || !states[3].Current || states[3].Changes != 2 {
+		t.Errorf("Unexpected state 3: %+v", states[3])
+	}
+}